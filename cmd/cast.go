@@ -0,0 +1,85 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// startCast records everything written to stdout and stderr to an asciicast
+// file at path, while still writing it to the terminal. The returned function
+// stops recording and closes the file.
+func startCast(path string) (func(), error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create asciicast file")
+	}
+
+	width, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	cast, err := stern.NewCast(f, width, height)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	var wg sync.WaitGroup
+	tee := func(out *os.File) (*os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create pipe")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.MultiWriter(out, cast), r)
+			r.Close()
+		}()
+		return w, nil
+	}
+
+	outW, err := tee(stdout)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	errW, err := tee(stderr)
+	if err != nil {
+		outW.Close()
+		f.Close()
+		return nil, err
+	}
+	os.Stdout, os.Stderr = outW, errW
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Stdout, os.Stderr = stdout, stderr
+			outW.Close()
+			errW.Close()
+			wg.Wait()
+			f.Close()
+		})
+	}, nil
+}
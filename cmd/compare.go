@@ -0,0 +1,149 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+)
+
+func newCompareCmd() *cobra.Command {
+	var baseline, candidate string
+	var duration time.Duration
+	compareOpts := stern.CompareOptions{
+		Window:    5 * time.Minute,
+		Interval:  10 * time.Second,
+		Threshold: -1,
+		MinLines:  100,
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Use = "compare --baseline GROUP --candidate GROUP"
+	cmd.Short = "Compare the error rates and message patterns of two groups of pods"
+	cmd.Long = `Tail a baseline and a candidate, like the stable and canary tracks of a
+rollout, and print the error rates and novel message patterns of both groups
+over a sliding window. A group is l=SELECTOR or a pod query.
+
+With --threshold, exits with 1 as soon as the error rate of the candidate
+exceeds the baseline's by more than the threshold, in percentage points.
+Otherwise exits with 0 once --duration passed or when interrupted, and with 2
+when an error occurred.`
+
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&baseline, "baseline", baseline, "The baseline group, as 'l=SELECTOR' or a pod query")
+	cmd.Flags().StringVar(&candidate, "candidate", candidate, "The candidate group, as 'l=SELECTOR' or a pod query")
+	cmd.Flags().DurationVar(&compareOpts.Window, "window", compareOpts.Window, "Time over which the groups are compared")
+	cmd.Flags().DurationVar(&compareOpts.Interval, "interval", compareOpts.Interval, "Time between two reports")
+	cmd.Flags().Float64Var(&compareOpts.Threshold, "threshold", compareOpts.Threshold, "Exit with 1 when the error rate of the candidate exceeds the baseline's by more than this many percentage points, negative to never fail")
+	cmd.Flags().IntVar(&compareOpts.MinLines, "min-lines", compareOpts.MinLines, "Number of lines both groups must log within the window before the threshold applies")
+	cmd.Flags().DurationVar(&duration, "duration", duration, "Stop comparing after this time, 0 to compare until interrupted")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 || baseline == "" || candidate == "" {
+			return cmd.Help()
+		}
+		if compareOpts.Window <= 0 || compareOpts.Interval <= 0 {
+			log.Println("window and interval should be greater than 0")
+			os.Exit(2)
+		}
+
+		baselineConfig, err := groupConfig(baseline)
+		if err != nil {
+			log.Println(errors.Wrap(err, "invalid baseline"))
+			os.Exit(2)
+		}
+		candidateConfig, err := groupConfig(candidate)
+		if err != nil {
+			log.Println(errors.Wrap(err, "invalid candidate"))
+			os.Exit(2)
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+		if duration > 0 {
+			go func() {
+				select {
+				case <-time.After(duration):
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		report, err := stern.Compare(ctx, baselineConfig, candidateConfig, compareOpts, func(r *stern.CompareReport) {
+			printComparison(os.Stdout, r)
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		printComparison(os.Stdout, report)
+		if report.Exceeded {
+			fmt.Fprintf(os.Stderr, "the error rate of the candidate exceeds the baseline's by %.2f points, more than the threshold of %g\n", report.Delta(), compareOpts.Threshold)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// groupConfig returns the config of a group, either l=SELECTOR, which is
+// combined with --selector, or a pod query
+func groupConfig(group string) (*stern.Config, error) {
+	o := *opts
+	if strings.HasPrefix(group, "l=") {
+		selector := strings.TrimPrefix(group, "l=")
+		if o.Selector != "" {
+			selector = o.Selector + "," + selector
+		}
+		o.Selector = selector
+		return o.Config("")
+	}
+	return o.Config(group)
+}
+
+// printComparison prints the stats of both groups and their novel patterns
+func printComparison(out io.Writer, r *stern.CompareReport) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\n%s, last %s\n", r.Time.Format("15:04:05"), r.Window)
+	fmt.Fprintln(w, "GROUP\tCONTAINERS\tLINES\tERRORS\tERROR RATE")
+	fmt.Fprintf(w, "baseline\t%d\t%d\t%d\t%.2f%%\n", r.Baseline.Containers, r.Baseline.Lines, r.Baseline.Errors, r.Baseline.ErrorRate())
+	fmt.Fprintf(w, "candidate\t%d\t%d\t%d\t%.2f%% (%+.2f)\n", r.Candidate.Containers, r.Candidate.Lines, r.Candidate.Errors, r.Candidate.ErrorRate(), r.Delta())
+	w.Flush()
+
+	for _, g := range []struct {
+		name  string
+		stats stern.GroupStats
+	}{{"candidate", r.Candidate}, {"baseline", r.Baseline}} {
+		if len(g.stats.Novel) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "only in %s:\n", g.name)
+		for _, p := range g.stats.Novel {
+			fmt.Fprintf(out, "%8d  %s\n", p.Count, p.Pattern)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/daemon"
+	"github.com/wercker/stern/kubernetes"
+	"github.com/wercker/stern/operator"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+func newDaemonCmd() *cobra.Command {
+	var (
+		leaseNamespace     string
+		leaseName          = "stern"
+		checkpointName     = "stern-checkpoint"
+		identity           string
+		listen             = ":8080"
+		sinkFile           string
+		sinkURL            string
+		checkpointInterval = 10 * time.Second
+	)
+
+	cmd := &cobra.Command{}
+	cmd.Use = "daemon [pod-query]"
+	cmd.Short = "Collect logs as one of several replicas, only the leader tailing"
+	cmd.Long = `Collect logs like stern does, as a long-lived process with replicas on
+standby. Only the replica holding a Lease tails, and a replica taking over
+resumes every container after the last line shipped, which is checkpointed in
+a ConfigMap. Serves /healthz and /readyz on --listen.`
+
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&leaseNamespace, "lease-namespace", leaseNamespace, "Namespace of the Lease and the checkpoint ConfigMap. Defaults to the namespace of the pod or the context.")
+	cmd.Flags().StringVar(&leaseName, "lease-name", leaseName, "Name of the Lease replicas compete for")
+	cmd.Flags().StringVar(&checkpointName, "checkpoint-name", checkpointName, "Name of the ConfigMap storing the time of the last line shipped per container")
+	cmd.Flags().DurationVar(&checkpointInterval, "checkpoint-interval", checkpointInterval, "How often the leader saves the checkpoint")
+	cmd.Flags().StringVar(&identity, "identity", identity, "Identity of this replica. Defaults to the hostname.")
+	cmd.Flags().StringVar(&listen, "listen", listen, "Address to serve /healthz and /readyz on, empty to disable")
+	cmd.Flags().StringVar(&sinkFile, "sink-file", sinkFile, "Append logs to this file instead of writing them to stdout")
+	cmd.Flags().StringVar(&sinkURL, "sink-http", sinkURL, "POST every log line to this URL instead of writing them to stdout")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return cmd.Help()
+		}
+		config, err := opts.Config(podQuery(args))
+		if err != nil {
+			return err
+		}
+		if config.ResourceQuery != nil {
+			return errors.New("resource queries aren't supported by the daemon")
+		}
+
+		restConfig, err := restConfig()
+		if err != nil {
+			return err
+		}
+		cs, err := clientset.NewForConfig(restConfig)
+		if err != nil {
+			return errors.Wrap(err, "failed to create clientset")
+		}
+
+		namespace, err := defaultNamespace()
+		if err != nil {
+			return err
+		}
+		if leaseNamespace == "" {
+			leaseNamespace = namespace
+		}
+		if config.AllNamespaces {
+			namespace = ""
+		} else if config.Namespace != "" {
+			namespace = config.Namespace
+		}
+
+		var sink operator.Sink
+		switch {
+		case sinkFile != "" && sinkURL != "":
+			return errors.New("only one of --sink-file and --sink-http can be used")
+		case sinkFile != "":
+			sink, err = operator.NewSink(operator.SinkSpec{File: &operator.FileSink{Path: sinkFile}})
+		case sinkURL != "":
+			sink, err = operator.NewSink(operator.SinkSpec{HTTP: &operator.HTTPSink{URL: sinkURL}})
+		default:
+			sink = operator.NewWriterSink(os.Stdout)
+		}
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+
+		d := daemon.NewDaemon(cs, config, namespace, sink)
+		d.LeaseNamespace = leaseNamespace
+		d.LeaseName = leaseName
+		d.CheckpointName = checkpointName
+		d.CheckpointInterval = checkpointInterval
+		if identity != "" {
+			d.Identity = identity
+		}
+
+		if listen != "" {
+			go func() {
+				if err := http.ListenAndServe(listen, d.Handler()); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to serve health endpoints: %s\n", err)
+				}
+			}()
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+		return d.Run(ctx)
+	}
+
+	return cmd
+}
+
+// defaultNamespace returns the namespace of the pod when running inside one
+// without a kubeconfig, and the namespace of the context otherwise
+func defaultNamespace() (string, error) {
+	kubeConfig, err := opts.KubeConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return kubernetes.Namespace(kubeConfig, opts.Context, opts.InCluster(kubeConfig))
+}
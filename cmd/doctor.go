@@ -0,0 +1,74 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+)
+
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = "doctor"
+	cmd.Short = "Check that stern can reach the cluster and tail logs"
+	cmd.Long = `Check the kubeconfig, the context and namespace, the auth plugin, the API
+server, the RBAC needed to tail, HTTP/2, the clock and colors, telling how to
+fix every failure. Exits with 1 when a check failed.`
+	cmd.Args = cobra.NoArgs
+
+	opts.AddFlags(cmd.Flags())
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		config, err := opts.Config("")
+		if err != nil {
+			return err
+		}
+
+		failed := false
+		stern.Doctor(context.Background(), config, func(check *stern.DoctorCheck) {
+			printDoctorCheck(check)
+			if check.Status == stern.DoctorFail {
+				failed = true
+			}
+		})
+		if failed {
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+var doctorColors = map[string]*color.Color{
+	stern.DoctorOK:   color.New(color.FgHiGreen),
+	stern.DoctorWarn: color.New(color.FgHiYellow),
+	stern.DoctorFail: color.New(color.FgHiRed, color.Bold),
+	stern.DoctorSkip: color.New(color.FgHiBlack),
+}
+
+// printDoctorCheck prints the result of a check and how to fix it
+func printDoctorCheck(check *stern.DoctorCheck) {
+	status := doctorColors[check.Status].Sprintf("%-4s", check.Status)
+	fmt.Printf("%s  %-12s %s\n", status, check.Name, check.Detail)
+	if check.Fix != "" {
+		fmt.Printf("      %-12s fix: %s\n", "", check.Fix)
+	}
+}
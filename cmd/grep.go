@@ -0,0 +1,142 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+)
+
+func newGrepCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = "grep pattern [pod-query]"
+	cmd.Short = "Search the logs of multiple pods without following them"
+	cmd.Long = `Fetch the logs of all matched containers in parallel, print the lines matching
+the pattern and a table of matches per pod. Exits with 0 when a line matched,
+1 when no line matched and 2 when an error occurred.`
+
+	opts.AddFlags(cmd.Flags())
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return cmd.Help()
+		}
+
+		pattern, err := regexp.Compile(args[0])
+		if err != nil {
+			log.Println(errors.Wrap(err, "failed to compile regular expression from pattern"))
+			os.Exit(2)
+		}
+
+		config, err := opts.Config(podQuery(args[1:]))
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+
+		if err := confirmVolume(config); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		results, err := stern.Grep(context.Background(), config, pattern, os.Stdout)
+		if err == stern.ErrDeclined {
+			os.Exit(2)
+		} else if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		os.Exit(printGrepSummary(results, config.AllNamespaces))
+		return nil
+	}
+
+	return cmd
+}
+
+// printGrepSummary prints the number of matches per pod and returns the exit
+// code, following grep's convention
+func printGrepSummary(results []*stern.GrepResult, allNamespaces bool) int {
+	type podMatches struct {
+		namespace string
+		pod       string
+		matches   int
+	}
+
+	var pods []*podMatches
+	byPod := make(map[string]*podMatches)
+	total := 0
+	failed := false
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintln(os.Stderr, r.Err)
+			failed = true
+		}
+
+		key := r.Namespace + "/" + r.Pod
+		pm, ok := byPod[key]
+		if !ok {
+			pm = &podMatches{namespace: r.Namespace, pod: r.Pod}
+			byPod[key] = pm
+			pods = append(pods, pm)
+		}
+		pm.matches += r.Matches
+		total += r.Matches
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool {
+		if pods[i].matches != pods[j].matches {
+			return pods[i].matches > pods[j].matches
+		}
+		if pods[i].namespace != pods[j].namespace {
+			return pods[i].namespace < pods[j].namespace
+		}
+		return pods[i].pod < pods[j].pod
+	})
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w)
+	if allNamespaces {
+		fmt.Fprintln(w, "NAMESPACE\tPOD\tMATCHES")
+	} else {
+		fmt.Fprintln(w, "POD\tMATCHES")
+	}
+	for _, pm := range pods {
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", pm.namespace, pm.pod, pm.matches)
+		} else {
+			fmt.Fprintf(w, "%s\t%d\n", pm.pod, pm.matches)
+		}
+	}
+	w.Flush()
+
+	switch {
+	case failed:
+		return 2
+	case total == 0:
+		return 1
+	default:
+		return 0
+	}
+}
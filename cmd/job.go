@@ -0,0 +1,42 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/wercker/stern/stern"
+)
+
+// printJobSummary prints the attempts of a Job and returns the exit code,
+// 0 when it completed and 1 when it failed
+func printJobSummary(result *stern.JobResult) int {
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "POD\tPHASE\tEXIT CODE\tREASON")
+	for _, p := range result.Pods {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", p.Name, p.Phase, p.ExitCode, p.Reason)
+	}
+	w.Flush()
+
+	if result.Succeeded {
+		fmt.Fprintf(os.Stderr, "job %s completed after %d attempts\n", result.Name, len(result.Pods))
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "job %s failed after %d attempts: %s %s\n", result.Name, len(result.Pods), result.Reason, result.Message)
+	return 1
+}
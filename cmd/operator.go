@@ -0,0 +1,104 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/kubernetes"
+	"github.com/wercker/stern/operator"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func newOperatorCmd() *cobra.Command {
+	var (
+		statusInterval = 10 * time.Second
+		policy         operator.Policy
+	)
+
+	cmd := &cobra.Command{}
+	cmd.Use = "operator"
+	cmd.Short = "Run the LogTail controller, shipping logs described by LogTail objects to their sinks"
+	cmd.Args = cobra.NoArgs
+
+	cmd.Flags().StringVar(&opts.Context, "context", opts.Context, "Kubernetes context to use. Default to current context configured in kubeconfig.")
+	cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", opts.Namespace, "Namespace to watch LogTail objects in. Defaults to all namespaces.")
+	cmd.Flags().StringVar(&opts.KubeConfig, "kubeconfig", opts.KubeConfig, "Path to kubeconfig file to use. Defaults to the in-cluster config when running inside a pod.")
+	cmd.Flags().DurationVar(&statusInterval, "status-interval", statusInterval, "How often the status of LogTail objects is updated")
+	cmd.Flags().StringSliceVar(&policy.CrossNamespace, "allow-cross-namespace", policy.CrossNamespace, "Namespaces whose LogTails may tail other namespaces or all namespaces, '*' for every namespace. By default LogTails only tail their own namespace.")
+	cmd.Flags().StringVar(&policy.FileSinkDir, "file-sink-dir", policy.FileSinkDir, "Directory file sinks are written under, in a directory per namespace. File sinks are refused when empty.")
+	cmd.Flags().StringArrayVar(&policy.HTTPSinkURLs, "allow-http-sink", policy.HTTPSinkURLs, "URL http sinks may post to, with the same scheme, host and port and a path below its path; specify multiple with additional --allow-http-sink")
+	cmd.Flags().StringArrayVar(&policy.SyslogSinkAddresses, "allow-syslog-sink", policy.SyslogSinkAddresses, "Remote address syslog sinks may send to; specify multiple with additional --allow-syslog-sink")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return errors.Wrap(err, "failed to create dynamic client")
+		}
+		cs, err := clientset.NewForConfig(config)
+		if err != nil {
+			return errors.Wrap(err, "failed to create clientset")
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		controller := operator.NewController(client, cs, opts.Namespace)
+		controller.StatusInterval = statusInterval
+		controller.Policy = policy
+		return controller.Run(ctx)
+	}
+
+	return cmd
+}
+
+// restConfig returns the config of the service account when running inside a
+// pod without a kubeconfig, and the config of the context otherwise
+func restConfig() (*rest.Config, error) {
+	kubeConfig, err := opts.KubeConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.RESTConfig(kubeConfig, opts.Context, opts.InCluster(kubeConfig))
+}
+
+// signalContext returns a context which is cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+	return ctx, cancel
+}
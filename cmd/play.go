@@ -0,0 +1,292 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func newPlayCmd() *cobra.Command {
+	var speed float64
+	var maxGap time.Duration
+	var start string
+	speed = 1
+	maxGap = 5 * time.Second
+
+	cmd := &cobra.Command{}
+	cmd.Use = "play file [pod-query]"
+	cmd.Short = "Replay logs saved with --output json"
+	cmd.Long = `Play logs saved with --output json in the terminal, with the timing they were
+logged with when they have timestamps. The query, filter and template flags
+apply as when tailing.
+
+Keys: space pauses and resumes, + and - change the speed, the left and right
+arrows seek 10s back and forth, g seeks to a time, / filters the messages
+with a regular expression and q quits.`
+
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().Float64Var(&speed, "speed", speed, "Playback speed, from 0.5 to 100")
+	cmd.Flags().DurationVar(&maxGap, "max-gap", maxGap, "Longest time to wait between two lines at 1x, 0 for no limit")
+	cmd.Flags().StringVar(&start, "start", start, "Time to start playing at, as 15:04:05 or RFC 3339")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return cmd.Help()
+		}
+		if speed < stern.PlaySpeeds[0] || speed > stern.PlaySpeeds[len(stern.PlaySpeeds)-1] {
+			log.Println("speed should be between 0.5 and 100")
+			os.Exit(1)
+		}
+
+		config, err := opts.Config(podQuery(args[1:]))
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		records, err := readRecordsFile(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if config.Namespace == "" && spansNamespaces(records) {
+			config.AllNamespaces = true
+		}
+
+		player := stern.NewPlayer(records, config)
+		player.Speed = speed
+		player.MaxGap = maxGap
+		if start != "" {
+			c, err := parseSeek(start, firstTime(records))
+			if err != nil || c.Time.IsZero() {
+				log.Println("start should be a time like 15:04:05 or in RFC 3339 format")
+				os.Exit(1)
+			}
+			player.Start = c.Time
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		var out io.Writer = os.Stdout
+		var controls <-chan stern.PlayControl
+		if args[0] != "-" && isatty.IsTerminal(os.Stdin.Fd()) {
+			state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+			if err != nil {
+				fmt.Println(errors.Wrap(err, "failed to read keys from the terminal"))
+				os.Exit(1)
+			}
+			defer terminal.Restore(int(os.Stdin.Fd()), state)
+
+			// the terminal doesn't translate newlines anymore
+			status := io.Writer(os.Stderr)
+			if isatty.IsTerminal(os.Stdout.Fd()) {
+				out = &crlfWriter{w: os.Stdout}
+			}
+			if isatty.IsTerminal(os.Stderr.Fd()) {
+				status = &crlfWriter{w: os.Stderr}
+			}
+			player.Status = status
+			controls = readControls(os.Stdin, status, firstTime(records), cancel)
+		}
+
+		return player.Play(ctx, out, controls)
+	}
+
+	return cmd
+}
+
+// readRecordsFile reads the records of a file, or of stdin for -
+func readRecordsFile(path string) ([]*stern.Record, error) {
+	if path == "-" {
+		return stern.ReadRecords(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open logs")
+	}
+	defer f.Close()
+	return stern.ReadRecords(f)
+}
+
+// spansNamespaces returns true when the records are from several namespaces
+func spansNamespaces(records []*stern.Record) bool {
+	for _, r := range records {
+		if r.Log.Namespace != records[0].Log.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// firstTime returns the time of the first record which has one
+func firstTime(records []*stern.Record) time.Time {
+	for _, r := range records {
+		if !r.Time.IsZero() {
+			return r.Time
+		}
+	}
+	return time.Time{}
+}
+
+// parseSeek parses a time to seek to: a duration like -30s relative to the
+// current record, a time of day on the day of reference, or an RFC 3339 time
+func parseSeek(s string, reference time.Time) (stern.PlayControl, error) {
+	c := stern.PlayControl{Action: stern.PlaySeek}
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		c.Offset = d
+		return c, err
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		c.Time = t
+		return c, nil
+	}
+	clock, err := time.Parse("15:04:05", s)
+	if err != nil || reference.IsZero() {
+		return c, errors.Errorf("can't seek to %q", s)
+	}
+	y, m, d := reference.Date()
+	c.Time = time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, reference.Location())
+	return c, nil
+}
+
+// readControls turns the keys pressed into controls of the player. q and ^C
+// call quit.
+func readControls(in io.Reader, echo io.Writer, reference time.Time, quit func()) <-chan stern.PlayControl {
+	controls := make(chan stern.PlayControl)
+	r := bufio.NewReader(in)
+
+	go func() {
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+
+			var c stern.PlayControl
+			switch b {
+			case ' ':
+				c.Action = stern.PlayTogglePause
+			case '+', '=':
+				c.Action = stern.PlayFaster
+			case '-', '_':
+				c.Action = stern.PlaySlower
+			case 'l':
+				c = stern.PlayControl{Action: stern.PlaySeek, Offset: 10 * time.Second}
+			case 'h':
+				c = stern.PlayControl{Action: stern.PlaySeek, Offset: -10 * time.Second}
+			case 0x1b:
+				// arrow keys are ESC [ C and ESC [ D
+				if next, _ := r.ReadByte(); next != '[' {
+					continue
+				}
+				switch arrow, _ := r.ReadByte(); arrow {
+				case 'C':
+					c = stern.PlayControl{Action: stern.PlaySeek, Offset: 10 * time.Second}
+				case 'D':
+					c = stern.PlayControl{Action: stern.PlaySeek, Offset: -10 * time.Second}
+				default:
+					continue
+				}
+			case 'g':
+				line, ok := readLine(r, echo, "seek to (15:04:05, RFC 3339 or ±duration): ")
+				if !ok {
+					continue
+				}
+				c, err = parseSeek(line, reference)
+				if err != nil {
+					fmt.Fprintf(echo, "%s\n", err)
+					continue
+				}
+			case '/':
+				line, ok := readLine(r, echo, "filter (empty for none): ")
+				if !ok {
+					continue
+				}
+				c.Action = stern.PlayFilter
+				if line != "" {
+					c.Filter, err = regexp.Compile(line)
+					if err != nil {
+						fmt.Fprintf(echo, "%s\n", errors.Wrap(err, "failed to compile filter"))
+						continue
+					}
+				}
+			case 'q', 3, 4:
+				quit()
+				return
+			default:
+				continue
+			}
+			controls <- c
+		}
+	}()
+
+	return controls
+}
+
+// readLine reads a line typed in a raw terminal, echoing it. It returns false
+// when the input was aborted with ESC or ^C.
+func readLine(r *bufio.Reader, echo io.Writer, prompt string) (string, bool) {
+	fmt.Fprint(echo, prompt)
+	var line []rune
+	for {
+		ch, _, err := r.ReadRune()
+		if err != nil {
+			return "", false
+		}
+		switch ch {
+		case '\r', '\n':
+			fmt.Fprint(echo, "\n")
+			return strings.TrimSpace(string(line)), true
+		case 0x1b, 3:
+			fmt.Fprint(echo, "\n")
+			return "", false
+		case 127, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(echo, "\b \b")
+			}
+		default:
+			line = append(line, ch)
+			fmt.Fprint(echo, string(ch))
+		}
+	}
+}
+
+// crlfWriter ends lines with \r\n for a terminal in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write([]byte(strings.Replace(string(p), "\n", "\r\n", -1))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,88 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+)
+
+func newRBACCmd() *cobra.Command {
+	var (
+		name     = "stern"
+		subjects []string
+	)
+
+	cmd := &cobra.Command{}
+	cmd.Use = "rbac [pod-query]"
+	cmd.Short = "Print the least-privilege RBAC needed to run a query"
+	cmd.Long = `Print the YAML of the Role, or ClusterRole, and of the binding granting the
+subjects exactly what stern needs to run the same query with the same flags.
+
+With --redact-secrets the role grants get on every secret of the namespace, or
+of every namespace for a ClusterRole, as RBAC can't restrict it to the secrets
+the tailed pods use. The output starts with a comment saying so.`
+
+	opts.AddFlags(cmd.Flags())
+	opts.AddFollowFlags(cmd.Flags())
+	cmd.Flags().StringVar(&name, "name", name, "Name of the roles and bindings")
+	cmd.Flags().StringArrayVar(&subjects, "subject", subjects, "Subject to grant, as user:NAME, group:NAME or serviceaccount:NAMESPACE:NAME; specify multiple with additional --subject")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return cmd.Help()
+		}
+
+		config, err := opts.Config(podQuery(args))
+		if err != nil {
+			return err
+		}
+		ipQuery := config.ResourceQuery != nil && config.ResourceQuery.Kind == stern.KindIP
+		if config.Namespace == "" && !config.AllNamespaces && !ipQuery {
+			if config.Namespace, err = defaultNamespace(); err != nil {
+				return err
+			}
+		}
+
+		options := stern.RBACOptions{Name: name}
+		for _, s := range subjects {
+			subject, err := stern.RBACSubject(s)
+			if err != nil {
+				return err
+			}
+			options.Subjects = append(options.Subjects, subject)
+		}
+		if len(options.Subjects) == 0 {
+			return errors.New("at least one --subject is required")
+		}
+
+		options.EstimateVolume, err = estimatesVolume(config)
+		if err != nil {
+			return err
+		}
+
+		out, err := stern.RBAC(config, options)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	}
+
+	return cmd
+}
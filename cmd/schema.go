@@ -0,0 +1,43 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wercker/stern/stern"
+)
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Use = "schema"
+	cmd.Short = "Print the JSON schema of the records of --output json"
+	cmd.Args = cobra.NoArgs
+
+	version := stern.JSONVersion
+	cmd.Flags().IntVar(&version, "json-version", version, "Version of the JSON output to print the schema of")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		schema, err := stern.JSONSchema(version)
+		if err != nil {
+			return err
+		}
+		fmt.Print(schema)
+		return nil
+	}
+
+	return cmd
+}
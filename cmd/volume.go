@@ -0,0 +1,85 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/wercker/stern/stern"
+)
+
+// estimatesVolume returns true when the volume of logs config would fetch is
+// estimated before fetching them. The total log usage of the containers says
+// nothing about the logs since a time, so --since skips the estimation like
+// --tail.
+func estimatesVolume(config *stern.Config) (bool, error) {
+	threshold, err := opts.VolumeThresholdBytes()
+	if err != nil {
+		return false, err
+	}
+	return threshold > 0 && !opts.AssumeYes && opts.Since == 0 && config.TailLines == nil && config.TailTotal == nil, nil
+}
+
+// confirmVolume sets config up to estimate the amount of logs it would fetch
+// and, above the volume threshold, ask for confirmation on a terminal or warn
+// otherwise. The logs aren't fetched when the user declined. Failing to
+// estimate only warns.
+func confirmVolume(config *stern.Config) error {
+	estimates, err := estimatesVolume(config)
+	if err != nil {
+		return err
+	}
+	if !estimates {
+		return nil
+	}
+	threshold, err := opts.VolumeThresholdBytes()
+	if err != nil {
+		return err
+	}
+
+	config.ConfirmVolume = func(estimate *stern.VolumeEstimate, err error) bool {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to estimate the amount of logs, fetching them anyway: %s\n", err)
+			return true
+		}
+		if !estimate.Exceeds(threshold) {
+			return true
+		}
+
+		msg := fmt.Sprintf("The %d matched containers have about %s of logs", estimate.Containers, stern.FormatBytes(estimate.Bytes))
+		if estimate.Unknown > 0 {
+			msg += fmt.Sprintf(", not counting %d containers whose log size is unknown", estimate.Unknown)
+		}
+
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			fmt.Fprintf(os.Stderr, "warning: %s. Use --tail, --since or --limit-bytes to fetch less.\n", msg)
+			return true
+		}
+
+		fmt.Fprintf(os.Stderr, "%s. Use --tail, --since or --limit-bytes to fetch less.\nFetch them anyway? [y/N] ", msg)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		default:
+			return false
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package daemon
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Checkpoint stores the time of the last line shipped per container in a
+// ConfigMap, so that the next leader resumes where the previous one stopped
+type Checkpoint struct {
+	client v1.ConfigMapInterface
+	name   string
+}
+
+// NewCheckpoint returns a checkpoint stored in the ConfigMap name
+func NewCheckpoint(client v1.ConfigMapInterface, name string) *Checkpoint {
+	return &Checkpoint{client: client, name: name}
+}
+
+// checkpointKey returns the ConfigMap key of a container. Namespaces and
+// container names can't contain dots, so keys are unique even though pod
+// names can.
+func checkpointKey(t *stern.Target) string {
+	return t.Namespace + "." + t.Pod + "." + t.Container
+}
+
+// Load returns the times stored by key, which are empty when the ConfigMap
+// doesn't exist yet
+func (c *Checkpoint) Load() (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	cm, err := c.client.Get(c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return times, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get checkpoint")
+	}
+
+	for key, value := range cm.Data {
+		ts, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil || strings.Count(key, ".") < 2 {
+			// not ours
+			continue
+		}
+		times[key] = ts
+	}
+	return times, nil
+}
+
+// Save replaces the stored times with times
+func (c *Checkpoint) Save(times map[string]time.Time) error {
+	data := make(map[string]string, len(times))
+	for key, ts := range times {
+		data[key] = ts.UTC().Format(time.RFC3339Nano)
+	}
+
+	cm, err := c.client.Get(c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = c.client.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.name},
+			Data:       data,
+		})
+		return errors.Wrap(err, "failed to create checkpoint")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get checkpoint")
+	}
+
+	cm.Data = data
+	_, err = c.client.Update(cm)
+	return errors.Wrap(err, "failed to update checkpoint")
+}
@@ -0,0 +1,91 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wercker/stern/stern"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckpoint(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := NewCheckpoint(clientset.CoreV1().ConfigMaps("logging"), "stern-checkpoint")
+
+	times, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 0 {
+		t.Errorf("expected no times before the first save, got %v", times)
+	}
+
+	key := checkpointKey(&stern.Target{Namespace: "shop", Pod: "web.v2-1", Container: "app"})
+	if key != "shop.web.v2-1.app" {
+		t.Errorf("unexpected key %s", key)
+	}
+
+	ts := time.Date(2019, 8, 1, 10, 0, 0, 123456789, time.UTC)
+	for i := 0; i < 2; i++ {
+		// creates, then updates
+		if err := c.Save(map[string]time.Time{key: ts.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	times, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ts.Add(time.Second); len(times) != 1 || !times[key].Equal(expected) {
+		t.Errorf("expected %s for %s, got %v", expected, key, times)
+	}
+}
+
+func TestCollectorSave(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	checkpoint := NewCheckpoint(clientset.CoreV1().ConfigMaps("logging"), "stern-checkpoint")
+
+	now := time.Now()
+	c := &collector{
+		config:     &stern.Config{Since: time.Hour},
+		checkpoint: checkpoint,
+		tails: map[string]*stern.Tail{
+			"shop.web-1.app": stern.NewTail("shop", "web-1", "app", nil, &stern.TailOptions{}),
+		},
+		times: map[string]time.Time{
+			"shop.web-1.app": now.Add(-2 * time.Hour),
+			"shop.web-0.app": now.Add(-2 * time.Hour),
+			"shop.web-2.app": now.Add(-time.Minute),
+		},
+	}
+	c.save()
+
+	times, err := checkpoint.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := times["shop.web-0.app"]; ok {
+		t.Errorf("expected the old time of a container which isn't tailed to be forgotten")
+	}
+	if _, ok := times["shop.web-1.app"]; !ok {
+		t.Errorf("expected the time of a tailed container to be kept")
+	}
+	if _, ok := times["shop.web-2.app"]; !ok {
+		t.Errorf("expected a recent time to be kept")
+	}
+}
@@ -0,0 +1,185 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/operator"
+	"github.com/wercker/stern/stern"
+)
+
+// collector ships the logs of the targets of a config to a sink while
+// leading, resuming every container from the checkpoint
+type collector struct {
+	source     stern.Source
+	config     *stern.Config
+	sink       operator.Sink
+	checkpoint *Checkpoint
+	interval   time.Duration
+
+	tails map[string]*stern.Tail
+	times map[string]time.Time
+}
+
+// run collects logs until ctx is done and saves the checkpoint a last time.
+// ready is called once the targets are watched.
+func (c *collector) run(ctx context.Context, ready func()) error {
+	times, err := c.checkpoint.Load()
+	if err != nil {
+		return err
+	}
+	c.times = times
+	c.tails = make(map[string]*stern.Tail)
+
+	added, removed, err := c.source.Watch(ctx, &stern.TargetFilter{
+		PodQuery:              c.config.PodQuery,
+		ContainerQuery:        c.config.ContainerQuery,
+		ExcludeContainerQuery: c.config.ExcludeContainerQuery,
+		InitContainers:        c.config.InitContainers,
+		ContainerState:        c.config.ContainerState,
+		LabelSelector:         c.config.LabelSelector,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to set up watch")
+	}
+	ready()
+
+	// unbuffered, so that the time a tail last saw was handed to the sink
+	logC := make(chan string)
+	done := make(chan struct{})
+	go c.ship(ctx, logC, done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p, ok := <-added:
+			if !ok {
+				added = nil
+				continue
+			}
+			key := checkpointKey(p)
+			if existing := c.tails[key]; existing != nil {
+				if existing.Active {
+					continue
+				}
+				// restart failed tail
+				c.record(key, existing)
+				existing.Close()
+			}
+			c.start(ctx, p, logC)
+
+		case p, ok := <-removed:
+			if !ok {
+				removed = nil
+				continue
+			}
+			key := checkpointKey(p)
+			if existing := c.tails[key]; existing != nil {
+				c.record(key, existing)
+				existing.Close()
+				delete(c.tails, key)
+			}
+
+		case <-ticker.C:
+			c.save()
+
+		case <-ctx.Done():
+			<-done
+			c.save()
+			go drain(logC)
+			return nil
+		}
+	}
+}
+
+// start tails a target, resuming after the last line shipped. The time of
+// the lines is tracked for containers without a checkpoint yet.
+func (c *collector) start(ctx context.Context, p *stern.Target, logC chan<- string) {
+	key := checkpointKey(p)
+	tail := stern.NewTail(p.Namespace, p.Pod, p.Container, c.config.Template, &stern.TailOptions{
+		Timestamps:   c.config.Timestamps,
+		SinceSeconds: int64(c.config.Since.Seconds()),
+		Exclude:      c.config.Exclude,
+		Include:      c.config.Include,
+		Namespace:    c.config.AllNamespaces,
+		TailLines:    c.config.TailLines,
+		OnlyLogLines: true,
+		Resume:       c.times[key],
+		TrackTime:    true,
+	})
+	tail.NodeName = p.Node
+	c.tails[key] = tail
+	tail.StartSource(ctx, c.source, logC)
+}
+
+// ship writes the lines to the sink until ctx is done
+func (c *collector) ship(ctx context.Context, logC <-chan string, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case line := <-logC:
+			if err := c.sink.Write(line); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write to sink: %s\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// record records the time a tail last saw
+func (c *collector) record(key string, tail *stern.Tail) {
+	if ts := tail.LastSeen(); !ts.IsZero() {
+		c.times[key] = ts
+	}
+}
+
+// save stores the times of the tails in the checkpoint. Containers which
+// aren't tailed anymore are forgotten once their logs are older than the
+// since option.
+func (c *collector) save() {
+	for key, tail := range c.tails {
+		c.record(key, tail)
+	}
+	oldest := time.Now().Add(-c.config.Since)
+	for key, ts := range c.times {
+		if c.tails[key] == nil && ts.Before(oldest) {
+			delete(c.times, key)
+		}
+	}
+
+	if err := c.checkpoint.Save(c.times); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+}
+
+// drain discards the lines tails were sending when the collector stopped,
+// until none came for a second, so that they can end
+func drain(logC <-chan string) {
+	for {
+		select {
+		case <-logC:
+		case <-time.After(time.Second):
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package daemon
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/wercker/stern/stern"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// lineSource is a source of one target logging one line, following until
+// ctx is done
+type lineSource struct {
+	target *stern.Target
+	line   string
+}
+
+func (s *lineSource) Watch(ctx context.Context, filter *stern.TargetFilter) (<-chan *stern.Target, <-chan *stern.Target, error) {
+	added := make(chan *stern.Target, 1)
+	added <- s.target
+	return added, make(chan *stern.Target), nil
+}
+
+func (s *lineSource) List(ctx context.Context, filter *stern.TargetFilter) ([]*stern.Target, error) {
+	return []*stern.Target{s.target}, nil
+}
+
+func (s *lineSource) Stream(ctx context.Context, target *stern.Target, opts *stern.StreamOptions) (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	go func() {
+		if opts.Timestamps {
+			io.WriteString(w, s.line)
+		} else {
+			io.WriteString(w, s.line[strings.IndexByte(s.line, ' ')+1:])
+		}
+		<-ctx.Done()
+		w.Close()
+	}()
+	return r, nil
+}
+
+// memorySink records the lines written to it
+type memorySink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *memorySink) Write(line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func (s *memorySink) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func TestCollectorCheckpointsNewContainer(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	checkpoint := NewCheckpoint(clientset.CoreV1().ConfigMaps("logging"), "stern-checkpoint")
+	sink := &memorySink{}
+
+	ts := time.Date(2019, 8, 1, 10, 0, 0, 123456789, time.UTC)
+	c := &collector{
+		source: &lineSource{
+			target: &stern.Target{Namespace: "shop", Pod: "web-1", Container: "app"},
+			line:   ts.Format(time.RFC3339Nano) + " started\n",
+		},
+		config: &stern.Config{
+			PodQuery:       regexp.MustCompile(".*"),
+			ContainerQuery: regexp.MustCompile(".*"),
+			LabelSelector:  labels.Everything(),
+			Since:          48 * time.Hour,
+			Template:       template.Must(template.New("").Parse("{{.Message}}")),
+		},
+		sink:       sink,
+		checkpoint: checkpoint,
+		interval:   time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error)
+	go func() { errC <- c.run(ctx, func() {}) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	// the timestamp is only used for the checkpoint
+	if lines := sink.written(); len(lines) != 1 || lines[0] != "started\n" {
+		t.Errorf("expected the line without timestamp, got %q", lines)
+	}
+
+	times, err := checkpoint.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := "shop.web-1.app"; !times[key].Equal(ts) {
+		t.Errorf("expected %s for %s, got %v", ts, key, times)
+	}
+}
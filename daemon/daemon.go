@@ -0,0 +1,220 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package daemon runs stern as a long-lived collector with replicas on
+// standby. Only the replica holding a Lease tails logs, and a replica taking
+// over resumes every container from a checkpoint.
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/operator"
+	"github.com/wercker/stern/stern"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Daemon ships logs to a sink while holding a Lease
+type Daemon struct {
+	clientset kubernetes.Interface
+	config    *stern.Config
+	namespace string
+	sink      operator.Sink
+
+	// LeaseNamespace holds the Lease and the checkpoint ConfigMap
+	LeaseNamespace string
+	LeaseName      string
+	CheckpointName string
+
+	// Identity tells replicas apart, it defaults to the hostname
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+
+	// CheckpointInterval is how often the checkpoint is saved while leading
+	CheckpointInterval time.Duration
+
+	// HandoverTimeout bounds the time to stop tailing and save the
+	// checkpoint before releasing the Lease
+	HandoverTimeout time.Duration
+
+	healthz *leaderelection.HealthzAdaptor
+
+	// ready is 1 when leading and watching targets, or on standby with a
+	// known leader
+	ready int32
+}
+
+// NewDaemon returns a daemon shipping the logs config matches in namespace,
+// an empty namespace tailing all namespaces, to sink
+func NewDaemon(clientset kubernetes.Interface, config *stern.Config, namespace string, sink operator.Sink) *Daemon {
+	identity, _ := os.Hostname()
+	return &Daemon{
+		clientset:          clientset,
+		config:             config,
+		namespace:          namespace,
+		sink:               sink,
+		LeaseNamespace:     "default",
+		LeaseName:          "stern",
+		CheckpointName:     "stern-checkpoint",
+		Identity:           identity,
+		LeaseDuration:      15 * time.Second,
+		RenewDeadline:      10 * time.Second,
+		RetryPeriod:        2 * time.Second,
+		CheckpointInterval: 10 * time.Second,
+		HandoverTimeout:    10 * time.Second,
+		healthz:            leaderelection.NewLeaderHealthzAdaptor(20 * time.Second),
+	}
+}
+
+// Run takes part in the leader election until ctx is done. When it is done
+// while leading, the collector stops and saves its checkpoint before the
+// Lease is released, so that a standby takes over right away. Run returns
+// early with the error of a collector which failed to start.
+func (d *Daemon) Run(ctx context.Context) error {
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock,
+		d.LeaseNamespace,
+		d.LeaseName,
+		d.clientset.CoreV1(),
+		d.clientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: d.Identity})
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease lock")
+	}
+
+	// the election outlives ctx until the collector handed over
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+	defer cancelElection()
+
+	// stopped is closed once the collector of the current term stopped
+	var mu sync.Mutex
+	var collectErr error
+	stopped := make(chan struct{})
+	close(stopped)
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   d.LeaseDuration,
+		RenewDeadline:   d.RenewDeadline,
+		RetryPeriod:     d.RetryPeriod,
+		ReleaseOnCancel: true,
+		WatchDog:        d.healthz,
+		Name:            d.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadingCtx context.Context) {
+				// the collector stops when leadership is lost or ctx is done
+				collectorCtx, cancel := context.WithCancel(leadingCtx)
+				go func() {
+					select {
+					case <-ctx.Done():
+					case <-collectorCtx.Done():
+					}
+					cancel()
+				}()
+
+				done := make(chan struct{})
+				mu.Lock()
+				stopped = done
+				mu.Unlock()
+				defer close(done)
+
+				fmt.Fprintf(os.Stderr, "%s started leading\n", d.Identity)
+				err := d.collector().run(collectorCtx, func() { atomic.StoreInt32(&d.ready, 1) })
+				atomic.StoreInt32(&d.ready, 0)
+				if err != nil {
+					// release the Lease and exit, letting another replica
+					// try
+					mu.Lock()
+					collectErr = err
+					mu.Unlock()
+					cancelElection()
+				}
+			},
+			OnStoppedLeading: func() {
+				fmt.Fprintf(os.Stderr, "%s stopped leading\n", d.Identity)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != d.Identity {
+					atomic.StoreInt32(&d.ready, 1)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create leader elector")
+	}
+
+	go func() {
+		<-ctx.Done()
+		// hand over: wait for the collector to save its checkpoint, then
+		// release the Lease
+		mu.Lock()
+		s := stopped
+		mu.Unlock()
+		select {
+		case <-s:
+		case <-time.After(d.HandoverTimeout):
+		}
+		cancelElection()
+	}()
+
+	elector.Run(electionCtx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return collectErr
+}
+
+func (d *Daemon) collector() *collector {
+	return &collector{
+		source:     stern.NewKubernetesSource(d.clientset, d.namespace),
+		config:     d.config,
+		sink:       d.sink,
+		checkpoint: NewCheckpoint(d.clientset.CoreV1().ConfigMaps(d.LeaseNamespace), d.CheckpointName),
+		interval:   d.CheckpointInterval,
+	}
+}
+
+// Handler serves /healthz, failing when the Lease wasn't renewed in time
+// while leading, and /readyz, failing until the daemon watches targets as the
+// leader or knows the leader on standby
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.healthz.Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&d.ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
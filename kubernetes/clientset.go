@@ -44,12 +44,12 @@ func NewClientConfig(configPath string, contextName string) clientcmd.ClientConf
 	)
 }
 
-// NewClientSet returns a new Kubernetes client for a client config
-func NewClientSet(clientConfig clientcmd.ClientConfig) (*kubernetes.Clientset, error) {
-	c, err := clientConfig.ClientConfig()
-
+// NewClientSet returns a new Kubernetes client for a context, or for the
+// service account of the pod when inCluster
+func NewClientSet(configPath string, contextName string, inCluster bool) (*kubernetes.Clientset, error) {
+	c, err := RESTConfig(configPath, contextName, inCluster)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get client config")
+		return nil, err
 	}
 
 	clientset, err := kubernetes.NewForConfig(c)
@@ -0,0 +1,90 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+)
+
+// serviceAccountNamespace is where Kubernetes mounts the namespace of a pod
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// InClusterConfig returns the config of the service account of the pod
+var InClusterConfig = rest.InClusterConfig
+
+// InCluster returns true when running inside a pod and none of the kubeconfig
+// files at path exist, in which case the service account of the pod is used.
+// A kubeconfig or a context given explicitly is never replaced, so that it
+// fails when it can't be used.
+func InCluster(path string, explicit bool) bool {
+	if explicit || os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return false
+	}
+	for _, p := range filepath.SplitList(path) {
+		if _, err := os.Stat(p); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// InClusterNamespace returns the namespace of the pod
+func InClusterNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if b, err := ioutil.ReadFile(serviceAccountNamespace); err == nil {
+		if ns := strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// RESTConfig returns the config of the service account of the pod when
+// inCluster, and the config of the context otherwise
+func RESTConfig(configPath string, contextName string, inCluster bool) (*rest.Config, error) {
+	if inCluster {
+		config, err := InClusterConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get in-cluster config")
+		}
+		return config, nil
+	}
+	config, err := NewClientConfig(configPath, contextName).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get client config")
+	}
+	return config, nil
+}
+
+// Namespace returns the namespace of the pod when inCluster, and the
+// namespace of the context otherwise
+func Namespace(configPath string, contextName string, inCluster bool) (string, error) {
+	if inCluster {
+		return InClusterNamespace(), nil
+	}
+	namespace, _, err := NewClientConfig(configPath, contextName).Namespace()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get default namespace")
+	}
+	return namespace, nil
+}
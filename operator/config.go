@@ -0,0 +1,166 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// logTailBackoff retries the streams of a LogTail for as long as it exists
+var logTailBackoff = stern.Backoff{Initial: time.Second, Max: time.Minute, MaxRetries: -1}
+
+// newConfig converts a LogTail spec into a stern config and the list of
+// namespaces to tail, an empty namespace meaning all namespaces. Only the
+// namespaces allowed by policy may tail other namespaces.
+func newConfig(lt *LogTail, policy Policy) (*stern.Config, []string, error) {
+	spec := lt.Spec
+
+	podQuery := spec.PodQuery
+	if podQuery == "" {
+		podQuery = ".*"
+	}
+	pod, err := regexp.Compile(podQuery)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to compile regular expression from podQuery")
+	}
+
+	containerQuery := spec.Container
+	if containerQuery == "" {
+		containerQuery = ".*"
+	}
+	container, err := regexp.Compile(containerQuery)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to compile regular expression for container")
+	}
+
+	var excludeContainer *regexp.Regexp
+	if spec.ExcludeContainer != "" {
+		excludeContainer, err = regexp.Compile(spec.ExcludeContainer)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to compile regular expression for excludeContainer")
+		}
+	}
+
+	var exclude []*regexp.Regexp
+	for _, ex := range spec.Exclude {
+		rex, err := regexp.Compile(ex)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to compile regular expression for exclude")
+		}
+		exclude = append(exclude, rex)
+	}
+
+	var include []*regexp.Regexp
+	for _, inc := range spec.Include {
+		rin, err := regexp.Compile(inc)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to compile regular expression for include")
+		}
+		include = append(include, rin)
+	}
+
+	states := spec.ContainerState
+	if len(states) == 0 {
+		states = []string{stern.RUNNING, stern.WAITING}
+	}
+	containerState, err := stern.NewContainerState(states)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	labelSelector := labels.Everything()
+	if spec.Selector != "" {
+		labelSelector, err = labels.Parse(spec.Selector)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse selector as label selector")
+		}
+	}
+
+	since := 48 * time.Hour
+	if spec.Since != "" {
+		since, err = time.ParseDuration(spec.Since)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse since as duration")
+		}
+	}
+
+	initContainers := true
+	if spec.InitContainers != nil {
+		initContainers = *spec.InitContainers
+	}
+
+	t := spec.Template
+	if t == "" {
+		switch spec.Output {
+		case "", "json":
+			t = "{{json .}}\n"
+		case "raw":
+			t = "{{.Message}}"
+		default:
+			return nil, nil, errors.New("output should be one of 'raw' or 'json'")
+		}
+	}
+	funs := map[string]interface{}{
+		"json": func(in interface{}) (string, error) {
+			b, err := json.Marshal(in)
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		},
+	}
+	tmpl, err := template.New("log").Funcs(funs).Parse(t)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to parse template")
+	}
+
+	if (spec.AllNamespaces || len(spec.Namespaces) > 0) && !policy.allowsCrossNamespace(lt.Namespace) {
+		return nil, nil, errors.Errorf("LogTails in namespace %s may only tail their own namespace", lt.Namespace)
+	}
+
+	var namespaces []string
+	switch {
+	case spec.AllNamespaces:
+		namespaces = []string{""}
+	case len(spec.Namespaces) > 0:
+		namespaces = spec.Namespaces
+	default:
+		namespaces = []string{lt.Namespace}
+	}
+
+	return &stern.Config{
+		PodQuery:              pod,
+		ContainerQuery:        container,
+		ExcludeContainerQuery: excludeContainer,
+		ContainerState:        containerState,
+		Exclude:               exclude,
+		Include:               include,
+		InitContainers:        initContainers,
+		Timestamps:            spec.Timestamps,
+		Since:                 since,
+		AllNamespaces:         spec.AllNamespaces,
+		LabelSelector:         labelSelector,
+		Template:              tmpl,
+		OnlyLogLines:          true,
+		Backoff:               logTailBackoff,
+	}, namespaces, nil
+}
@@ -0,0 +1,267 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Controller reconciles LogTail objects by running a tail for each of them
+// and reporting its progress in the status
+type Controller struct {
+	client    dynamic.Interface
+	namespace string
+
+	// StatusInterval is how often the status of every LogTail is updated
+	StatusInterval time.Duration
+
+	// Policy limits what LogTail objects may do
+	Policy Policy
+
+	start func(ctx context.Context, lt *LogTail) (tailer, error)
+
+	mu      sync.Mutex
+	tailers map[string]*managed
+}
+
+type managed struct {
+	generation int64
+	tailer     tailer
+	err        error
+}
+
+// NewController returns a controller for the LogTail objects in namespace,
+// an empty namespace watching all namespaces
+func NewController(client dynamic.Interface, clientset kubernetes.Interface, namespace string) *Controller {
+	c := &Controller{
+		client:         client,
+		namespace:      namespace,
+		StatusInterval: 10 * time.Second,
+		tailers:        make(map[string]*managed),
+	}
+	c.start = func(ctx context.Context, lt *LogTail) (tailer, error) {
+		return startRunner(ctx, clientset, lt, c.Policy)
+	}
+	return c
+}
+
+// Run reconciles LogTail objects until ctx is done
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.stopAll()
+
+	go func() {
+		ticker := time.NewTicker(c.StatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.updateStatuses()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		list, err := c.resource().List(metav1.ListOptions{})
+		if err != nil {
+			return errors.Wrap(err, "failed to list logtails")
+		}
+
+		seen := make(map[string]bool)
+		for i := range list.Items {
+			u := &list.Items[i]
+			seen[key(u)] = true
+			c.reconcile(ctx, u)
+		}
+		for _, k := range c.keys() {
+			if !seen[k] {
+				c.remove(k)
+			}
+		}
+
+		watcher, err := c.resource().Watch(metav1.ListOptions{ResourceVersion: list.GetResourceVersion()})
+		if err != nil {
+			return errors.Wrap(err, "failed to watch logtails")
+		}
+		if done := c.handleEvents(ctx, watcher); done {
+			return nil
+		}
+	}
+}
+
+// handleEvents processes watch events until the watch is closed or ctx is
+// done, in which case it returns true
+func (c *Controller) handleEvents(ctx context.Context, watcher watch.Interface) bool {
+	defer watcher.Stop()
+
+	for {
+		select {
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+			u, ok := e.Object.(*unstructured.Unstructured)
+			if !ok {
+				// most likely a *metav1.Status for an expired resource version
+				return false
+			}
+
+			switch e.Type {
+			case watch.Added, watch.Modified:
+				c.reconcile(ctx, u)
+			case watch.Deleted:
+				c.remove(key(u))
+			}
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
+
+// reconcile (re)starts the tail of a LogTail if its spec changed
+func (c *Controller) reconcile(ctx context.Context, u *unstructured.Unstructured) {
+	k := key(u)
+	generation := u.GetGeneration()
+
+	c.mu.Lock()
+	existing := c.tailers[k]
+	c.mu.Unlock()
+	if existing != nil && existing.generation == generation {
+		return
+	}
+	if existing != nil {
+		c.remove(k)
+	}
+
+	m := &managed{generation: generation}
+	lt, err := fromUnstructured(u)
+	if err == nil {
+		m.tailer, err = c.start(ctx, lt)
+	}
+	m.err = err
+
+	c.mu.Lock()
+	c.tailers[k] = m
+	c.mu.Unlock()
+
+	c.writeStatus(u.GetNamespace(), u.GetName(), m)
+}
+
+func (c *Controller) remove(k string) {
+	c.mu.Lock()
+	m := c.tailers[k]
+	delete(c.tailers, k)
+	c.mu.Unlock()
+
+	if m != nil && m.tailer != nil {
+		m.tailer.Stop()
+	}
+}
+
+func (c *Controller) stopAll() {
+	for _, k := range c.keys() {
+		c.remove(k)
+	}
+}
+
+func (c *Controller) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+	for k := range c.tailers {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *Controller) updateStatuses() {
+	c.mu.Lock()
+	tailers := make(map[string]*managed, len(c.tailers))
+	for k, m := range c.tailers {
+		tailers[k] = m
+	}
+	c.mu.Unlock()
+
+	for k, m := range tailers {
+		namespace, name := splitKey(k)
+		c.writeStatus(namespace, name, m)
+	}
+}
+
+func (c *Controller) writeStatus(namespace, name string, m *managed) {
+	var status LogTailStatus
+	if m.err != nil {
+		status = LogTailStatus{
+			Phase:     PhaseFailed,
+			Errors:    1,
+			LastError: m.err.Error(),
+		}
+	} else {
+		status = m.tailer.Status()
+	}
+	status.ObservedGeneration = m.generation
+
+	if err := c.updateStatus(namespace, name, status); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to update status of logtail %s/%s: %s\n", namespace, name, err)
+	}
+}
+
+func (c *Controller) updateStatus(namespace, name string, status LogTailStatus) error {
+	u, err := c.client.Resource(LogTailResource).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	content, err := statusToUnstructured(status)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(u.Object, content, "status"); err != nil {
+		return err
+	}
+
+	_, err = c.client.Resource(LogTailResource).Namespace(namespace).UpdateStatus(u, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Controller) resource() dynamic.ResourceInterface {
+	if c.namespace == "" {
+		return c.client.Resource(LogTailResource)
+	}
+	return c.client.Resource(LogTailResource).Namespace(c.namespace)
+}
+
+func key(u *unstructured.Unstructured) string {
+	return u.GetNamespace() + "/" + u.GetName()
+}
+
+func splitKey(k string) (namespace, name string) {
+	parts := strings.SplitN(k, "/", 2)
+	return parts[0], parts[1]
+}
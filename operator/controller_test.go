@@ -0,0 +1,208 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type fakeTailer struct {
+	stopped bool
+}
+
+func (f *fakeTailer) Status() LogTailStatus {
+	return LogTailStatus{Phase: PhaseRunning, ActiveTargets: 2, LinesShipped: 42}
+}
+
+func (f *fakeTailer) Stop() {
+	f.stopped = true
+}
+
+func newLogTail(generation int64, podQuery string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "stern.wercker.com/v1alpha1",
+		"kind":       "LogTail",
+		"metadata": map[string]interface{}{
+			"namespace":  "default",
+			"name":       "capture",
+			"generation": generation,
+		},
+		"spec": map[string]interface{}{
+			"podQuery": podQuery,
+			"sink": map[string]interface{}{
+				"file": map[string]interface{}{"path": "/tmp/capture.log"},
+			},
+		},
+	}}
+	return u
+}
+
+func newTestController(objects ...runtime.Object) (*Controller, *[]*fakeTailer) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	c := NewController(client, nil, "")
+	var started []*fakeTailer
+	c.start = func(ctx context.Context, lt *LogTail) (tailer, error) {
+		if _, _, err := newConfig(lt, c.Policy); err != nil {
+			return nil, err
+		}
+		f := &fakeTailer{}
+		started = append(started, f)
+		return f, nil
+	}
+	return c, &started
+}
+
+func TestReconcileRestartsOnSpecChange(t *testing.T) {
+	lt := newLogTail(1, "web")
+	c, started := newTestController(lt)
+	ctx := context.Background()
+
+	c.reconcile(ctx, lt)
+	c.reconcile(ctx, lt)
+	if len(*started) != 1 {
+		t.Fatalf("expected 1 tailer to be started, got %d", len(*started))
+	}
+
+	c.reconcile(ctx, newLogTail(2, "api"))
+	if len(*started) != 2 {
+		t.Fatalf("expected tailer to be restarted, got %d starts", len(*started))
+	}
+	if !(*started)[0].stopped {
+		t.Errorf("expected previous tailer to be stopped")
+	}
+
+	c.remove(key(lt))
+	if !(*started)[1].stopped {
+		t.Errorf("expected tailer to be stopped on delete")
+	}
+}
+
+func TestReconcileReportsStatus(t *testing.T) {
+	lt := newLogTail(3, "web")
+	c, _ := newTestController(lt)
+
+	c.reconcile(context.Background(), lt)
+
+	u, err := c.client.Resource(LogTailResource).Namespace("default").Get("capture", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fromUnstructured(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Phase != PhaseRunning || got.Status.ActiveTargets != 2 || got.Status.LinesShipped != 42 {
+		t.Errorf("unexpected status %+v", got.Status)
+	}
+	if got.Status.ObservedGeneration != 3 {
+		t.Errorf("expected observed generation 3, got %d", got.Status.ObservedGeneration)
+	}
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	lt := newLogTail(1, "(")
+	c, started := newTestController(lt)
+
+	c.reconcile(context.Background(), lt)
+	if len(*started) != 0 {
+		t.Fatalf("expected no tailer for an invalid spec")
+	}
+
+	u, err := c.client.Resource(LogTailResource).Namespace("default").Get("capture", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fromUnstructured(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Phase != PhaseFailed || got.Status.LastError == "" {
+		t.Errorf("expected failed status, got %+v", got.Status)
+	}
+}
+
+func TestNewConfigNamespaces(t *testing.T) {
+	allowed := Policy{CrossNamespace: []string{"logging"}}
+	tests := []struct {
+		namespace string
+		spec      LogTailSpec
+		policy    Policy
+		expected  []string
+		err       bool
+	}{
+		{"default", LogTailSpec{}, Policy{}, []string{"default"}, false},
+		{"default", LogTailSpec{Namespaces: []string{"a", "b"}}, Policy{}, nil, true},
+		{"default", LogTailSpec{AllNamespaces: true}, allowed, nil, true},
+		{"logging", LogTailSpec{Namespaces: []string{"a", "b"}}, allowed, []string{"a", "b"}, false},
+		{"logging", LogTailSpec{Namespaces: []string{"a"}, AllNamespaces: true}, allowed, []string{""}, false},
+		{"shop", LogTailSpec{AllNamespaces: true}, Policy{CrossNamespace: []string{"*"}}, []string{""}, false},
+	}
+
+	for i, tt := range tests {
+		lt := &LogTail{Spec: tt.spec}
+		lt.Namespace = tt.namespace
+		_, namespaces, err := newConfig(lt, tt.policy)
+		if (err != nil) != tt.err {
+			t.Fatalf("%d: unexpected error %v", i, err)
+		}
+		if len(namespaces) != len(tt.expected) {
+			t.Fatalf("%d: expected %v, got %v", i, tt.expected, namespaces)
+		}
+		for j := range namespaces {
+			if namespaces[j] != tt.expected[j] {
+				t.Errorf("%d: expected %v, got %v", i, tt.expected, namespaces)
+			}
+		}
+	}
+}
+
+func TestPolicySink(t *testing.T) {
+	policy := Policy{
+		FileSinkDir:         "/var/log/stern",
+		HTTPSinkURLs:        []string{"https://logs.example.com/"},
+		SyslogSinkAddresses: []string{"syslog:514"},
+	}
+	tests := []struct {
+		policy   Policy
+		sink     SinkSpec
+		expected string
+		err      bool
+	}{
+		{policy, SinkSpec{File: &FileSink{Path: "capture.log"}}, "/var/log/stern/shop/capture.log", false},
+		{policy, SinkSpec{File: &FileSink{Path: "incidents/capture.log"}}, "/var/log/stern/shop/incidents/capture.log", false},
+		{policy, SinkSpec{File: &FileSink{Path: "/etc/passwd"}}, "", true},
+		{policy, SinkSpec{File: &FileSink{Path: "../other/capture.log"}}, "", true},
+		{policy, SinkSpec{File: &FileSink{Path: "a/../../capture.log"}}, "", true},
+		{Policy{}, SinkSpec{File: &FileSink{Path: "capture.log"}}, "", true},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com/shop"}}, "", false},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com:443/shop/a"}}, "", false},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "http://169.254.169.254/"}}, "", true},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com.attacker.net/"}}, "", true},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com@evil/"}}, "", true},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com:8443/"}}, "", true},
+		{policy, SinkSpec{HTTP: &HTTPSink{URL: "http://logs.example.com/"}}, "", true},
+		{Policy{HTTPSinkURLs: []string{"https://logs.example.com/shop"}}, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com/shopping"}}, "", true},
+		{Policy{HTTPSinkURLs: []string{"https://logs.example.com/shop"}}, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com/shop/../admin"}}, "", true},
+		{Policy{HTTPSinkURLs: []string{"https://logs.example.com"}}, SinkSpec{HTTP: &HTTPSink{URL: "https://logs.example.com.attacker.net"}}, "", true},
+		{policy, SinkSpec{Syslog: &SyslogSink{}}, "", false},
+		{policy, SinkSpec{Syslog: &SyslogSink{Network: "tcp", Address: "syslog:514"}}, "", false},
+		{policy, SinkSpec{Syslog: &SyslogSink{Network: "tcp", Address: "attacker:514"}}, "", true},
+	}
+
+	for i, tt := range tests {
+		lt := &LogTail{Spec: LogTailSpec{Sink: tt.sink}}
+		lt.Namespace = "shop"
+		spec, err := tt.policy.sink(lt)
+		if (err != nil) != tt.err {
+			t.Errorf("%d: unexpected error %v", i, err)
+			continue
+		}
+		if tt.expected != "" && spec.File.Path != tt.expected {
+			t.Errorf("%d: expected path %s, got %s", i, tt.expected, spec.File.Path)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Policy is what the admin of the operator allows LogTail objects to do. The
+// operator reads logs and writes sinks with its own permissions, so the zero
+// policy confines every LogTail to the logs of its namespace and to the local
+// syslog.
+type Policy struct {
+	// CrossNamespace lists the namespaces whose LogTails may set namespaces
+	// or allNamespaces, "*" allowing every namespace
+	CrossNamespace []string
+
+	// FileSinkDir is the directory file sinks are written under, in a
+	// directory per namespace. File sinks are refused when it's empty.
+	FileSinkDir string
+
+	// HTTPSinkURLs are the URLs http sinks may post to. The scheme, host and
+	// port of a sink must be those of one of them, and its path must be below
+	// that one's path.
+	HTTPSinkURLs []string
+
+	// SyslogSinkAddresses are the remote addresses syslog sinks may send to
+	SyslogSinkAddresses []string
+}
+
+// allowsCrossNamespace returns true when the LogTails of namespace may tail
+// other namespaces
+func (p *Policy) allowsCrossNamespace(namespace string) bool {
+	for _, ns := range p.CrossNamespace {
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// sink returns the sink of a LogTail once checked against the policy, with
+// the path of a file sink under the directory of its namespace
+func (p *Policy) sink(lt *LogTail) (SinkSpec, error) {
+	spec := lt.Spec.Sink
+
+	if spec.File != nil {
+		if p.FileSinkDir == "" {
+			return spec, errors.New("file sinks aren't allowed by the operator")
+		}
+		path := spec.File.Path
+		if path == "" || filepath.IsAbs(path) {
+			return spec, errors.New("file sink path should be relative to the directory of the namespace")
+		}
+		for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+			if elem == ".." {
+				return spec, errors.New("file sink path must not contain '..'")
+			}
+		}
+		file := *spec.File
+		file.Path = filepath.Join(p.FileSinkDir, lt.Namespace, path)
+		spec.File = &file
+	}
+
+	if spec.HTTP != nil && !allowsURL(p.HTTPSinkURLs, spec.HTTP.URL) {
+		return spec, errors.Errorf("http sink %s isn't allowed by the operator", spec.HTTP.URL)
+	}
+
+	if spec.Syslog != nil && spec.Syslog.Network != "" && !contains(p.SyslogSinkAddresses, spec.Syslog.Address) {
+		return spec, errors.Errorf("syslog sink %s isn't allowed by the operator", spec.Syslog.Address)
+	}
+
+	return spec, nil
+}
+
+// allowsURL returns true when the scheme, host and port of rawurl are those
+// of one of the allowed URLs and its path is below that one's path
+func allowsURL(allowed []string, rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User != nil || u.Opaque != "" || u.Host == "" {
+		return false
+	}
+	for _, a := range allowed {
+		prefix, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, prefix.Scheme) || !strings.EqualFold(u.Hostname(), prefix.Hostname()) || urlPort(u) != urlPort(prefix) {
+			continue
+		}
+		if underPath(u.Path, prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlPort returns the port of a URL, or the default one of its scheme
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// underPath returns true when p is dir or below it once cleaned
+func underPath(p, dir string) bool {
+	p = path.Clean("/" + p)
+	dir = path.Clean("/" + dir)
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
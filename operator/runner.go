@@ -0,0 +1,177 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+	"k8s.io/client-go/kubernetes"
+)
+
+// tailer is a running LogTail
+type tailer interface {
+	Status() LogTailStatus
+	Stop()
+}
+
+// runner ships the logs of a single LogTail to its sink by running stern on
+// a source per namespace, with the same retries as the stern command
+type runner struct {
+	cancel context.CancelFunc
+	sink   Sink
+	done   chan struct{}
+
+	// writeMu serializes the writes of the namespaces to the sink
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	lastError string
+	failed    bool
+
+	active int64
+	lines  int64
+	errors int64
+}
+
+func startRunner(ctx context.Context, clientset kubernetes.Interface, lt *LogTail, policy Policy) (tailer, error) {
+	config, namespaces, err := newConfig(lt, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := policy.sink(lt)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := NewSink(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []stern.Source
+	for _, ns := range namespaces {
+		sources = append(sources, stern.NewKubernetesSource(clientset, ns))
+	}
+	return newRunner(ctx, sources, config, sink), nil
+}
+
+// newRunner tails config from every source to sink until it's stopped
+func newRunner(ctx context.Context, sources []stern.Source, config *stern.Config, sink Sink) *runner {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &runner{
+		cancel: cancel,
+		sink:   sink,
+		done:   make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source stern.Source) {
+			defer wg.Done()
+			if err := stern.RunSource(ctx, &countingSource{Source: source, r: r}, config, r); err != nil {
+				r.mu.Lock()
+				r.failed = true
+				r.mu.Unlock()
+				r.recordError(err)
+			}
+		}(source)
+	}
+
+	go func() {
+		defer close(r.done)
+		wg.Wait()
+		r.sink.Close()
+	}()
+
+	return r
+}
+
+// Write ships a line printed by stern to the sink
+func (r *runner) Write(p []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := r.sink.Write(string(p)); err != nil {
+		r.recordError(errors.Wrap(err, "failed to write to sink"))
+		return len(p), nil
+	}
+	atomic.AddInt64(&r.lines, 1)
+	return len(p), nil
+}
+
+func (r *runner) recordError(err error) {
+	atomic.AddInt64(&r.errors, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastError = err.Error()
+}
+
+// Status returns the current status of the runner
+func (r *runner) Status() LogTailStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	phase := PhaseRunning
+	if r.failed {
+		phase = PhaseFailed
+	}
+	return LogTailStatus{
+		Phase:         phase,
+		ActiveTargets: int(atomic.LoadInt64(&r.active)),
+		LinesShipped:  atomic.LoadInt64(&r.lines),
+		Errors:        atomic.LoadInt64(&r.errors),
+		LastError:     r.lastError,
+	}
+}
+
+// Stop stops all tails and closes the sink
+func (r *runner) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// countingSource counts the streams of a runner which are open, and those
+// which failed to open as errors
+type countingSource struct {
+	stern.Source
+	r *runner
+}
+
+func (s *countingSource) Stream(ctx context.Context, target *stern.Target, opts *stern.StreamOptions) (io.ReadCloser, error) {
+	stream, err := s.Source.Stream(ctx, target, opts)
+	if err != nil {
+		s.r.recordError(err)
+		return nil, err
+	}
+	atomic.AddInt64(&s.r.active, 1)
+	return &countedStream{ReadCloser: stream, active: &s.r.active}, nil
+}
+
+// countedStream is an open stream of a countingSource
+type countedStream struct {
+	io.ReadCloser
+	active *int64
+	once   sync.Once
+}
+
+func (s *countedStream) Close() error {
+	s.once.Do(func() { atomic.AddInt64(s.active, -1) })
+	return s.ReadCloser.Close()
+}
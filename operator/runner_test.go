@@ -0,0 +1,87 @@
+package operator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// flakySource has a single target whose stream fails to open once
+type flakySource struct {
+	mu     sync.Mutex
+	failed bool
+}
+
+func (s *flakySource) Watch(ctx context.Context, filter *stern.TargetFilter) (<-chan *stern.Target, <-chan *stern.Target, error) {
+	added := make(chan *stern.Target, 1)
+	added <- &stern.Target{Namespace: "shop", Pod: "web-1", Container: "nginx"}
+	return added, make(chan *stern.Target), nil
+}
+
+func (s *flakySource) List(ctx context.Context, filter *stern.TargetFilter) ([]*stern.Target, error) {
+	return nil, nil
+}
+
+func (s *flakySource) Stream(ctx context.Context, target *stern.Target, opts *stern.StreamOptions) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.failed {
+		s.failed = true
+		return nil, errors.New("connection reset by peer")
+	}
+	return ioutil.NopCloser(strings.NewReader("GET / 200\nGET /api 500\n")), nil
+}
+
+// memorySink keeps the lines written to it
+type memorySink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *memorySink) Write(line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestRunnerRetries(t *testing.T) {
+	config := &stern.Config{
+		PodQuery:       regexp.MustCompile(".*"),
+		ContainerQuery: regexp.MustCompile(".*"),
+		LabelSelector:  labels.Everything(),
+		ContainerState: stern.ContainerState{stern.RUNNING},
+		Template:       template.Must(template.New("log").Parse("{{.Message}}")),
+		OnlyLogLines:   true,
+		Backoff:        stern.Backoff{Initial: time.Millisecond, Max: time.Millisecond, MaxRetries: -1},
+	}
+	sink := &memorySink{}
+	r := newRunner(context.Background(), []stern.Source{&flakySource{}}, config, sink)
+	time.Sleep(100 * time.Millisecond)
+	r.Stop()
+
+	status := r.Status()
+	if status.Errors != 1 || !strings.Contains(status.LastError, "connection reset by peer") {
+		t.Errorf("expected the failed stream to be counted, got %+v", status)
+	}
+	if status.LinesShipped != 2 || status.ActiveTargets != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if strings.Join(sink.lines, "") != "GET / 200\nGET /api 500\n" {
+		t.Errorf("unexpected lines %q", sink.lines)
+	}
+}
@@ -0,0 +1,146 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sink receives the formatted log lines of a LogTail
+type Sink interface {
+	Write(line string) error
+	Close() error
+}
+
+// NewSink opens the sink described by spec
+func NewSink(spec SinkSpec) (Sink, error) {
+	n := 0
+	if spec.File != nil {
+		n++
+	}
+	if spec.HTTP != nil {
+		n++
+	}
+	if spec.Syslog != nil {
+		n++
+	}
+	if n != 1 {
+		return nil, errors.New("sink should specify exactly one of 'file', 'http' or 'syslog'")
+	}
+
+	switch {
+	case spec.File != nil:
+		return newFileSink(spec.File)
+	case spec.HTTP != nil:
+		return newHTTPSink(spec.HTTP)
+	default:
+		return newSyslogSink(spec.Syslog)
+	}
+}
+
+// NewWriterSink returns a sink writing to w, such as stdout
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(line string) error {
+	_, err := io.WriteString(s.w, line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(spec *FileSink) (Sink, error) {
+	if spec.Path == "" {
+		return nil, errors.New("file sink requires a path")
+	}
+	if err := os.MkdirAll(filepath.Dir(spec.Path), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create directory for file sink")
+	}
+	f, err := os.OpenFile(spec.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file sink")
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Write(line string) error {
+	_, err := s.f.WriteString(line)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSink(spec *HTTPSink) (Sink, error) {
+	if spec.URL == "" {
+		return nil, errors.New("http sink requires a url")
+	}
+	return &httpSink{
+		url:     spec.URL,
+		headers: spec.Headers,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *httpSink) Write(line string) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewBufferString(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http sink returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package operator
+
+import (
+	"log/syslog"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(spec *SyslogSink) (Sink, error) {
+	tag := spec.Tag
+	if tag == "" {
+		tag = "stern"
+	}
+	w, err := syslog.Dial(spec.Network, spec.Address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to syslog")
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(line string) error {
+	return s.w.Info(strings.TrimRight(line, "\r\n"))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
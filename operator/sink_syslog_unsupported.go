@@ -0,0 +1,26 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+//go:build windows || plan9
+// +build windows plan9
+
+package operator
+
+import (
+	"github.com/pkg/errors"
+)
+
+func newSyslogSink(spec *SyslogSink) (Sink, error) {
+	return nil, errors.New("syslog sink is not supported on this platform")
+}
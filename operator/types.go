@@ -0,0 +1,149 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package operator
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// LogTailResource is the resource served by the LogTail CRD
+var LogTailResource = schema.GroupVersionResource{
+	Group:    "stern.wercker.com",
+	Version:  "v1alpha1",
+	Resource: "logtails",
+}
+
+// LogTail describes a set of containers whose logs should be shipped to a
+// sink for as long as the object exists
+type LogTail struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LogTailSpec   `json:"spec"`
+	Status LogTailStatus `json:"status,omitempty"`
+}
+
+// LogTailSpec mirrors the stern command line flags
+type LogTailSpec struct {
+	// Namespaces to tail. Defaults to the namespace of the LogTail, the only
+	// one allowed unless the operator's policy allows more.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// AllNamespaces tails across all namespaces, Namespaces is ignored
+	AllNamespaces bool `json:"allNamespaces,omitempty"`
+
+	// PodQuery is a regular expression matched against pod names. Defaults
+	// to ".*".
+	PodQuery string `json:"podQuery,omitempty"`
+
+	// Selector is a label selector to filter pods on
+	Selector string `json:"selector,omitempty"`
+
+	// Container is a regular expression matched against container names.
+	// Defaults to ".*".
+	Container string `json:"container,omitempty"`
+
+	// ExcludeContainer is a regular expression of container names to skip
+	ExcludeContainer string `json:"excludeContainer,omitempty"`
+
+	// ContainerState is the list of states a container has to be in to be
+	// tailed. Defaults to running and waiting.
+	ContainerState []string `json:"containerState,omitempty"`
+
+	// InitContainers includes init containers. Defaults to true.
+	InitContainers *bool `json:"initContainers,omitempty"`
+
+	// Include is a list of regular expressions of log lines to include
+	Include []string `json:"include,omitempty"`
+
+	// Exclude is a list of regular expressions of log lines to exclude
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Since is a duration like 5s, 2m or 3h. Defaults to 48h.
+	Since string `json:"since,omitempty"`
+
+	// Timestamps prefixes every line with its timestamp
+	Timestamps bool `json:"timestamps,omitempty"`
+
+	// Output is one of raw or json. Defaults to json.
+	Output string `json:"output,omitempty"`
+
+	// Template overrides Output with a custom template
+	Template string `json:"template,omitempty"`
+
+	// Sink is where the log lines are shipped to
+	Sink SinkSpec `json:"sink"`
+}
+
+// SinkSpec holds exactly one sink
+type SinkSpec struct {
+	File   *FileSink   `json:"file,omitempty"`
+	HTTP   *HTTPSink   `json:"http,omitempty"`
+	Syslog *SyslogSink `json:"syslog,omitempty"`
+}
+
+// FileSink appends lines to a file, typically on a mounted PVC. The path is
+// relative to the directory of the namespace under the operator's file sink
+// directory.
+type FileSink struct {
+	Path string `json:"path"`
+}
+
+// HTTPSink POSTs every line to an endpoint
+type HTTPSink struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// SyslogSink sends lines to a syslog daemon
+type SyslogSink struct {
+	// Network is tcp or udp. Leave empty for the local syslog.
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// LogTailStatus is reported by the controller
+type LogTailStatus struct {
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	ActiveTargets      int    `json:"activeTargets"`
+	LinesShipped       int64  `json:"linesShipped"`
+	Errors             int64  `json:"errors"`
+	LastError          string `json:"lastError,omitempty"`
+}
+
+const (
+	// PhaseRunning means the LogTail is being tailed
+	PhaseRunning = "Running"
+
+	// PhaseFailed means the spec is invalid or the sink can't be opened
+	PhaseFailed = "Failed"
+)
+
+func fromUnstructured(u *unstructured.Unstructured) (*LogTail, error) {
+	lt := &LogTail{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), lt); err != nil {
+		return nil, err
+	}
+	return lt, nil
+}
+
+func statusToUnstructured(status LogTailStatus) (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+}
@@ -0,0 +1,128 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/stern"
+)
+
+// File is the stern config file
+type File struct {
+	// Templates are tried in order, the first one matching a container
+	// replaces the template from the command line
+	Templates []TemplateRule `json:"templates,omitempty"`
+}
+
+// TemplateRule maps the containers matching Pod and Container, both regular
+// expressions, to a custom template or a predefined output
+type TemplateRule struct {
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Template  string `json:"template,omitempty"`
+}
+
+// configFilePath returns the config file to use, which is empty when none was
+// given and the default one doesn't exist
+func (o *Options) configFilePath() (string, error) {
+	if o.ConfigFile != "" {
+		return o.ConfigFile, nil
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get user home directory")
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	path := filepath.Join(dir, "stern", "config.yaml")
+	if _, err := os.Stat(path); err != nil {
+		return "", nil
+	}
+	return path, nil
+}
+
+// readFile reads the config file, returning an empty one if there is none
+func (o *Options) readFile() (*File, error) {
+	path, err := o.configFilePath()
+	if err != nil || path == "" {
+		return &File{}, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+
+	file := &File{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	return file, nil
+}
+
+// templateRules returns the template rules of the config file. They only
+// apply to the text outputs, every container keeps the json and trace outputs
+// and a custom template from the command line.
+func (o *Options) templateRules(trace *stern.Trace) ([]stern.TemplateRule, error) {
+	file, err := o.readFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []stern.TemplateRule
+	for i, r := range file.Templates {
+		var rule stern.TemplateRule
+		if r.Pod != "" {
+			rule.PodQuery, err = regexp.Compile(r.Pod)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to compile regular expression for pod of template %d", i+1)
+			}
+		}
+		if r.Container != "" {
+			rule.ContainerQuery, err = regexp.Compile(r.Container)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to compile regular expression for container of template %d", i+1)
+			}
+		}
+		if r.Output == "" && r.Template == "" {
+			return nil, errors.Errorf("template %d should have an output or a template", i+1)
+		}
+		if r.Template == "" && (r.Output == "json" || r.Output == "trace") {
+			return nil, errors.Errorf("template %d can't use the %s output, only the command line can", i+1, r.Output)
+		}
+		rule.Template, err = o.template(r.Output, r.Template, trace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "template %d", i+1)
+		}
+		rules = append(rules, rule)
+	}
+
+	if o.Template != "" || o.Output == "json" || o.Output == "trace" {
+		return nil, nil
+	}
+	return rules, nil
+}
@@ -0,0 +1,558 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package options holds the command line options of stern, so that other
+// command line tools can embed stern with the same flags.
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"github.com/wercker/stern/kubernetes"
+	"github.com/wercker/stern/stern"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Options are the command line options of stern
+type Options struct {
+	Container        string
+	ExcludeContainer string
+	ContainerState   []string
+	Timestamps       bool
+	Since            time.Duration
+	Context          string
+	Namespace        string
+	KubeConfig       string
+	Exclude          []string
+	Include          []string
+	InitContainers   bool
+	AllNamespaces    bool
+	Selector         string
+	Tail             int64
+	TailTotal        int64
+	MaxLogRequests   int
+	Color            string
+	Template         string
+	Output           string
+	JSONVersion      int
+	MaxRetries       int
+	RetryDelay       time.Duration
+	ConfigFile       string
+	RedactSecrets    bool
+	LimitBytes       int64
+	VolumeThreshold  string
+	AssumeYes        bool
+	Sidecars         string
+	Headers          bool
+
+	JournalUnits []string
+	JournalFiles []string
+	LocalFiles   []string
+
+	OnMatch            []string
+	OnMatchConcurrency int
+	OnMatchDebounce    time.Duration
+	OnMatchTimeout     time.Duration
+}
+
+// Option changes the default options
+type Option func(*Options)
+
+// WithKubeConfig sets the path to the kubeconfig file
+func WithKubeConfig(path string) Option {
+	return func(o *Options) { o.KubeConfig = path }
+}
+
+// WithContext sets the Kubernetes context
+func WithContext(context string) Option {
+	return func(o *Options) { o.Context = context }
+}
+
+// WithNamespace sets the namespace to tail
+func WithNamespace(namespace string) Option {
+	return func(o *Options) { o.Namespace = namespace }
+}
+
+// WithAllNamespaces tails across all namespaces
+func WithAllNamespaces() Option {
+	return func(o *Options) { o.AllNamespaces = true }
+}
+
+// WithSelector sets the label selector
+func WithSelector(selector string) Option {
+	return func(o *Options) { o.Selector = selector }
+}
+
+// WithContainer sets the container query
+func WithContainer(container string) Option {
+	return func(o *Options) { o.Container = container }
+}
+
+// WithSince sets how far back logs are shown
+func WithSince(since time.Duration) Option {
+	return func(o *Options) { o.Since = since }
+}
+
+// WithOutput sets the predefined template
+func WithOutput(output string) Option {
+	return func(o *Options) { o.Output = output }
+}
+
+// WithColor sets the color mode, one of always, never or auto
+func WithColor(color string) Option {
+	return func(o *Options) { o.Color = color }
+}
+
+// New returns the default options, changed by opts
+func New(opts ...Option) *Options {
+	o := &Options{
+		Container:       ".*",
+		ContainerState:  []string{stern.RUNNING, stern.WAITING},
+		InitContainers:  true,
+		Tail:            -1,
+		TailTotal:       -1,
+		MaxLogRequests:  10,
+		Color:           "auto",
+		Output:          "default",
+		JSONVersion:     0,
+		MaxRetries:      10,
+		RetryDelay:      time.Second,
+		VolumeThreshold: "1Gi",
+		Sidecars:        stern.SidecarsShow,
+
+		OnMatchConcurrency: 2,
+		OnMatchDebounce:    time.Minute,
+		OnMatchTimeout:     time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// AddFlags adds the flags selecting and formatting the logs to fs
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.Container, "container", "c", o.Container, "Container name when multiple containers in pod")
+	fs.StringVarP(&o.ExcludeContainer, "exclude-container", "E", o.ExcludeContainer, "Exclude a Container name")
+	fs.StringSliceVar(&o.ContainerState, "container-state", o.ContainerState, "If present, tail containers with status in running, waiting or terminated. Default to running and waiting.")
+	fs.BoolVarP(&o.Timestamps, "timestamps", "t", o.Timestamps, "Print timestamps")
+	fs.DurationVarP(&o.Since, "since", "s", o.Since, "Return logs newer than a relative duration like 5s, 2m, or 3h. Defaults to 48h.")
+	fs.StringVar(&o.Context, "context", o.Context, "Kubernetes context to use. Default to current context configured in kubeconfig.")
+	fs.StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "Kubernetes namespace to use. Default to namespace configured in Kubernetes context")
+	fs.StringVar(&o.KubeConfig, "kubeconfig", o.KubeConfig, "Path to kubeconfig file to use")
+	fs.StringVar(&o.KubeConfig, "kube-config", o.KubeConfig, "Path to kubeconfig file to use")
+	fs.MarkDeprecated("kube-config", "Use --kubeconfig instead.")
+	fs.StringSliceVarP(&o.Exclude, "exclude", "e", o.Exclude, "Regex of log lines to exclude")
+	fs.StringSliceVarP(&o.Include, "include", "i", o.Include, "Regex of log lines to include")
+	fs.BoolVar(&o.InitContainers, "init-containers", o.InitContainers, "Include init containers")
+	fs.BoolVar(&o.AllNamespaces, "all-namespaces", o.AllNamespaces, "If present, tail across all namespaces. A specific namespace is ignored even if specified with --namespace.")
+	fs.StringVarP(&o.Selector, "selector", "l", o.Selector, "Selector (label query) to filter on. If present, default to \".*\" for the pod-query.")
+	fs.Int64Var(&o.Tail, "tail", o.Tail, "The number of lines from the end of the logs to show. Defaults to -1, showing all logs.")
+	fs.IntVar(&o.MaxLogRequests, "max-log-requests", o.MaxLogRequests, "Maximum number of logs fetched at the same time")
+	fs.StringVar(&o.Color, "color", o.Color, "Color output. Can be 'always', 'never', or 'auto'")
+	fs.StringVar(&o.Template, "template", o.Template, "Template to use for log lines, leave empty to use --output flag")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "Specify predefined template. Currently support: [default, pretty, raw, json, trace]")
+	fs.IntVar(&o.JSONVersion, "json-version", o.JSONVersion, "Version of the JSON output of --output json, see 'stern schema'")
+	fs.Int64Var(&o.LimitBytes, "limit-bytes", o.LimitBytes, "Maximum number of bytes of logs to fetch per container. Defaults to 0, no limit.")
+	fs.StringVar(&o.VolumeThreshold, "volume-threshold", o.VolumeThreshold, "Estimated amount of logs above which to ask for confirmation before fetching them, 0 to disable")
+	fs.BoolVarP(&o.AssumeYes, "yes", "y", o.AssumeYes, "Fetch the logs without asking for confirmation")
+	fs.StringVar(&o.Sidecars, "sidecars", o.Sidecars, "How to tail known sidecars like istio-proxy or vault-agent: 'show' like other containers, 'quiet' to only show their warnings and errors, or 'hide'")
+	fs.BoolVar(&o.RedactSecrets, "redact-secrets", o.RedactSecrets, "Mask the values of the secrets used by a pod in its logs, including their base64 forms")
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "Path to the stern config file. Defaults to ~/.config/stern/config.yaml if it exists.")
+}
+
+// AddFollowFlags adds the flags which only apply when following logs to fs
+func (o *Options) AddFollowFlags(fs *pflag.FlagSet) {
+	fs.Int64Var(&o.TailTotal, "tail-total", o.TailTotal, "The number of most recent lines across all containers to show before following. Defaults to -1, using --tail instead.")
+	fs.IntVar(&o.MaxRetries, "max-retries", o.MaxRetries, "Maximum number of times to retry opening the log stream of a container, -1 for unlimited")
+	fs.DurationVar(&o.RetryDelay, "retry-delay", o.RetryDelay, "Initial delay between retries, doubled on every attempt up to a minute")
+	fs.StringArrayVar(&o.JournalUnits, "journal-unit", o.JournalUnits, "Merge the journal of a systemd unit of this host, like kubelet, into the output; specify multiple with additional --journal-unit")
+	fs.StringArrayVar(&o.JournalFiles, "journal-file", o.JournalFiles, "Merge the entries of a journal export file, as written by journalctl -o export, into the output instead of following journalctl")
+	fs.BoolVar(&o.Headers, "headers", o.Headers, "Print a '==> namespace/pod/container <==' header when the container of the lines changes, like tail -f with several files, instead of prefixing every line")
+	fs.StringArrayVar(&o.LocalFiles, "local-file", o.LocalFiles, "Follow a local file, or the files matching a glob, next to the pods like tail -F; specify multiple with additional --local-file")
+	fs.StringArrayVar(&o.OnMatch, "on-match", o.OnMatch, "Run a command with sh when a log line matches, as 'regex=command'. The line is passed on stdin and the target in STERN_* environment variables.")
+	fs.IntVar(&o.OnMatchConcurrency, "on-match-concurrency", o.OnMatchConcurrency, "Maximum number of --on-match commands running at the same time")
+	fs.DurationVar(&o.OnMatchDebounce, "on-match-debounce", o.OnMatchDebounce, "Time during which further matches of an --on-match hook on the same container are ignored")
+	fs.DurationVar(&o.OnMatchTimeout, "on-match-timeout", o.OnMatchTimeout, "Kill --on-match commands running longer, 0 for no timeout")
+}
+
+// Validate returns an error when the options can't be converted into a config
+func (o *Options) Validate() error {
+	_, err := o.config(".*")
+	return err
+}
+
+// Config validates the options and converts them into a config tailing the
+// pods matching podQuery, which defaults to ".*". podQuery can also be a
+// resource query like ip/10.2.3.4. Config also applies the color option to the
+// color package.
+func (o *Options) Config(podQuery string) (*stern.Config, error) {
+	if podQuery == "" {
+		podQuery = ".*"
+	}
+	resourceQuery := stern.ParseResourceQuery(podQuery)
+	if resourceQuery != nil {
+		podQuery = ".*"
+	}
+	config, err := o.config(podQuery)
+	if err != nil {
+		return nil, err
+	}
+	config.ResourceQuery = resourceQuery
+
+	config.KubeConfig, err = o.KubeConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	config.InCluster = o.InCluster(config.KubeConfig)
+
+	if config.Envelope && !config.InCluster {
+		config.Cluster = o.clusterName(config.KubeConfig)
+	}
+
+	color.NoColor = o.noColor()
+
+	return config, nil
+}
+
+// KubeConfigPath returns the kubeconfig file to use, from the options, the
+// KUBECONFIG environment variable or the home directory
+func (o *Options) KubeConfigPath() (string, error) {
+	var kubeconfig string
+
+	if kubeconfig = o.KubeConfig; kubeconfig != "" {
+		return kubeconfig, nil
+	}
+
+	if kubeconfig = os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return kubeconfig, nil
+	}
+
+	// kubernetes requires an absolute path
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user home directory")
+	}
+
+	kubeconfig = filepath.Join(home, ".kube/config")
+
+	return kubeconfig, nil
+}
+
+// InCluster returns true when the service account of the pod stern runs in is
+// used instead of the kubeconfig, which is only the case when neither a
+// kubeconfig nor a context were given
+func (o *Options) InCluster(kubeconfig string) bool {
+	explicit := o.KubeConfig != "" || os.Getenv("KUBECONFIG") != "" || o.Context != ""
+	return kubernetes.InCluster(kubeconfig, explicit)
+}
+
+// VolumeThresholdBytes returns the volume threshold in bytes, 0 meaning the
+// volume shouldn't be estimated
+func (o *Options) VolumeThresholdBytes() (int64, error) {
+	if o.VolumeThreshold == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(o.VolumeThreshold)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse volume threshold")
+	}
+	return q.Value(), nil
+}
+
+// clusterName returns the cluster of the context, or an empty string when the
+// kubeconfig can't be loaded
+func (o *Options) clusterName(kubeconfig string) string {
+	raw, err := kubernetes.NewClientConfig(kubeconfig, o.Context).RawConfig()
+	if err != nil {
+		return ""
+	}
+	context := o.Context
+	if context == "" {
+		context = raw.CurrentContext
+	}
+	if c, ok := raw.Contexts[context]; ok {
+		return c.Cluster
+	}
+	return ""
+}
+
+func (o *Options) noColor() bool {
+	switch o.Color {
+	case "always":
+		return false
+	case "never":
+		return true
+	default:
+		return color.NoColor
+	}
+}
+
+// config converts the options into a config. It reads the config file but
+// leaves the options unchanged, so that it can be called more than once.
+func (o *Options) config(podQuery string) (*stern.Config, error) {
+	pod, err := regexp.Compile(podQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile regular expression from query")
+	}
+
+	container, err := regexp.Compile(o.Container)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile regular expression for container query")
+	}
+
+	var excludeContainer *regexp.Regexp
+	if o.ExcludeContainer != "" {
+		excludeContainer, err = regexp.Compile(o.ExcludeContainer)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile regular expression for exclude container query")
+		}
+	}
+
+	switch o.Sidecars {
+	case "", stern.SidecarsShow, stern.SidecarsQuiet:
+	case stern.SidecarsHide:
+		excludeContainer = stern.ExcludeSidecars(excludeContainer)
+	default:
+		return nil, errors.Errorf("sidecars should be one of '%s'", strings.Join(stern.SidecarModes, "', '"))
+	}
+
+	var exclude []*regexp.Regexp
+	for _, ex := range o.Exclude {
+		rex, err := regexp.Compile(ex)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile regular expression for exclusion filter")
+		}
+
+		exclude = append(exclude, rex)
+	}
+
+	var include []*regexp.Regexp
+	for _, inc := range o.Include {
+		rin, err := regexp.Compile(inc)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile regular expression for inclusion filter")
+		}
+
+		include = append(include, rin)
+	}
+
+	containerState, err := stern.NewContainerState(o.ContainerState)
+	if err != nil {
+		return nil, err
+	}
+
+	var labelSelector labels.Selector
+	if o.Selector == "" {
+		labelSelector = labels.Everything()
+	} else {
+		labelSelector, err = labels.Parse(o.Selector)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse selector as label selector")
+		}
+	}
+
+	var tailLines *int64
+	if o.Tail < -1 {
+		return nil, errors.New("tail should be -1 or greater")
+	} else if o.Tail != -1 {
+		tail := o.Tail
+		tailLines = &tail
+	}
+
+	var tailTotal *int64
+	if o.TailTotal < -1 {
+		return nil, errors.New("tail-total should be -1 or greater")
+	} else if o.TailTotal != -1 {
+		total := o.TailTotal
+		tailTotal = &total
+	}
+
+	var limitBytes *int64
+	if o.LimitBytes < 0 {
+		return nil, errors.New("limit-bytes should be 0 or greater")
+	} else if o.LimitBytes > 0 {
+		limit := o.LimitBytes
+		limitBytes = &limit
+	}
+
+	if _, err := o.VolumeThresholdBytes(); err != nil {
+		return nil, err
+	}
+
+	if o.MaxLogRequests < 1 {
+		return nil, errors.New("max-log-requests should be at least 1")
+	}
+
+	var hooks []stern.Hook
+	for _, s := range o.OnMatch {
+		hook, err := stern.ParseHook(s)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	if o.OnMatchConcurrency < 1 {
+		return nil, errors.New("on-match-concurrency should be at least 1")
+	}
+
+	if o.JSONVersion < 0 || o.JSONVersion > stern.JSONVersion {
+		return nil, errors.Errorf("json-version should be between 0 and %d", stern.JSONVersion)
+	}
+
+	if o.Color != "always" && o.Color != "never" && o.Color != "auto" {
+		return nil, errors.New("color should be one of 'always', 'never', or 'auto'")
+	}
+
+	// the templates of the trace output number the same targets alike
+	trace := stern.NewTrace()
+	tmpl, err := o.template(o.Output, o.Template, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	templateRules, err := o.templateRules(trace)
+	if err != nil {
+		return nil, err
+	}
+
+	since := o.Since
+	if since == 0 {
+		since = 48 * time.Hour
+	}
+
+	return &stern.Config{
+		PodQuery:              pod,
+		ContainerQuery:        container,
+		ExcludeContainerQuery: excludeContainer,
+		ContainerState:        containerState,
+		Exclude:               exclude,
+		Include:               include,
+		InitContainers:        o.InitContainers,
+		Timestamps:            o.Timestamps,
+		Since:                 since,
+		ContextName:           o.Context,
+		Namespace:             o.Namespace,
+		AllNamespaces:         o.AllNamespaces,
+		LabelSelector:         labelSelector,
+		TailLines:             tailLines,
+		TailTotal:             tailTotal,
+		LimitBytes:            limitBytes,
+		MaxLogRequests:        o.MaxLogRequests,
+		Template:              tmpl,
+		TemplateRules:         templateRules,
+		RedactSecrets:         o.RedactSecrets,
+		Sidecars:              o.Sidecars,
+		JournalUnits:          o.JournalUnits,
+		JournalFiles:          o.JournalFiles,
+		LocalFiles:            o.LocalFiles,
+		Headers:               o.Headers,
+		Trace:                 o.Template == "" && o.Output == "trace",
+		Envelope:              o.Template == "" && ((o.Output == "json" && o.JSONVersion > 0) || o.Output == "trace"),
+		Backoff: stern.Backoff{
+			Initial:    o.RetryDelay,
+			Max:        time.Minute,
+			MaxRetries: o.MaxRetries,
+		},
+		Hooks: hooks,
+		HookLimits: stern.HookLimits{
+			Concurrency: o.OnMatchConcurrency,
+			Debounce:    o.OnMatchDebounce,
+			Timeout:     o.OnMatchTimeout,
+		},
+	}, nil
+}
+
+// template returns the custom template if any, or the predefined one for
+// output, writing the events of the trace output to trace
+func (o *Options) template(output, custom string, trace *stern.Trace) (*template.Template, error) {
+	t := custom
+	if t == "" {
+		var prefix string
+		switch {
+		case o.Headers:
+			// the headers name the containers
+		case o.noColor():
+			prefix = "{{.PodName}} {{.ContainerName}} "
+			if o.AllNamespaces {
+				prefix = "{{.Namespace}} " + prefix
+			}
+		default:
+			prefix = "{{color .PodColor .PodName}} {{color .ContainerColor .ContainerName}} "
+			if o.AllNamespaces {
+				prefix = "{{color .PodColor .Namespace}} " + prefix
+			}
+		}
+
+		if o.Headers && (output == "json" || output == "trace") {
+			return nil, errors.Errorf("headers can't be used with the %s output", output)
+		}
+
+		switch output {
+		case "default":
+			t = prefix + "{{.Message}}"
+		case "pretty":
+			t = prefix + "{{prettyJSON .Message}}"
+		case "raw":
+			t = "{{.Message}}"
+		case "json":
+			t = fmt.Sprintf("{{envelope %d .}}\n", o.JSONVersion)
+		case "trace":
+			t = "{{trace .}}"
+		default:
+			return nil, errors.New("output should be one of 'default', 'pretty', 'raw', 'json' or 'trace'")
+		}
+	}
+
+	funs := map[string]interface{}{
+		"json": func(in interface{}) (string, error) {
+			b, err := json.Marshal(in)
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		},
+		"envelope": stern.MarshalEnvelope,
+		"trace":    trace.Event,
+		"prettyJSON": func(msg string) string {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, []byte(strings.TrimSpace(msg)), "", "  "); err != nil {
+				return msg
+			}
+			return buf.String() + "\n"
+		},
+		"color": func(color color.Color, text string) string {
+			return color.SprintFunc()(text)
+		},
+	}
+	tmpl, err := template.New("log").Funcs(funs).Parse(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	return tmpl, nil
+}
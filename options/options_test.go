@@ -0,0 +1,242 @@
+package options
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/wercker/stern/stern"
+)
+
+func TestAddFlags(t *testing.T) {
+	o := New(WithNamespace("default"))
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	o.AddFlags(fs)
+	o.AddFollowFlags(fs)
+
+	err := fs.Parse([]string{"-n", "staging", "-c", "app", "--tail", "5", "--since", "1h", "--max-retries", "3", "-e", "healthz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := o.Config("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Namespace != "staging" {
+		t.Errorf("expected namespace staging, got %s", config.Namespace)
+	}
+	if config.ContainerQuery.String() != "app" || config.PodQuery.String() != "web" {
+		t.Errorf("unexpected queries %s and %s", config.PodQuery, config.ContainerQuery)
+	}
+	if config.TailLines == nil || *config.TailLines != 5 {
+		t.Errorf("expected tail lines 5, got %v", config.TailLines)
+	}
+	if config.Since != time.Hour {
+		t.Errorf("expected since 1h, got %s", config.Since)
+	}
+	if config.Backoff.MaxRetries != 3 {
+		t.Errorf("expected 3 retries, got %d", config.Backoff.MaxRetries)
+	}
+	if len(config.Exclude) != 1 {
+		t.Errorf("expected 1 exclusion filter, got %d", len(config.Exclude))
+	}
+	if !config.InitContainers {
+		t.Errorf("expected init containers to be included by default")
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	config, err := New(WithColor("never")).Config("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.PodQuery.String() != ".*" {
+		t.Errorf("expected pod query .*, got %s", config.PodQuery)
+	}
+	if config.Since != 48*time.Hour {
+		t.Errorf("expected since 48h, got %s", config.Since)
+	}
+	if config.TailLines != nil || config.TailTotal != nil {
+		t.Errorf("expected no tail limits by default")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+	}{
+		{"container", New(WithContainer("("))},
+		{"selector", New(WithSelector("a in (b"))},
+		{"color", New(WithColor("sometimes"))},
+		{"output", New(WithOutput("yaml"))},
+		{"headers", &Options{Container: ".*", ContainerState: []string{"running"}, Tail: -1, TailTotal: -1, MaxLogRequests: 1, Color: "auto", Output: "json", Sidecars: "show", Headers: true}},
+		{"sidecars", &Options{Container: ".*", ContainerState: []string{"running"}, Tail: -1, TailTotal: -1, MaxLogRequests: 1, Color: "auto", Output: "raw", Sidecars: "mute"}},
+		{"tail", &Options{Container: ".*", ContainerState: []string{"running"}, Tail: -2, TailTotal: -1, MaxLogRequests: 1, Color: "auto", Output: "raw"}},
+		{"container-state", &Options{Container: ".*", ContainerState: []string{"sleeping"}, Tail: -1, TailTotal: -1, MaxLogRequests: 1, Color: "auto", Output: "raw"}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	o := New(WithOutput("trace"))
+	before := *o
+	if err := o.Validate(); err != nil {
+		t.Errorf("expected default options to be valid, got %s", err)
+	}
+	if !reflect.DeepEqual(*o, before) {
+		t.Errorf("expected validating to leave the options unchanged")
+	}
+}
+
+func TestJSONVersion(t *testing.T) {
+	log := stern.Log{PodName: "api", ContainerName: "app", Namespace: "ns", Message: "hello\n"}
+
+	tests := []struct {
+		version  int
+		envelope bool
+		expected string
+	}{
+		{0, false, `{"message":"hello\n","namespace":"ns","podName":"api","containerName":"app"}` + "\n"},
+		{1, true, `{"version":1,"type":"log","namespace":"ns","pod":"api","container":"app","message":"hello"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		o := New(WithOutput("json"), WithColor("never"))
+		o.JSONVersion = tt.version
+		config, err := o.Config("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Envelope != tt.envelope {
+			t.Errorf("version %d: expected envelope %v", tt.version, tt.envelope)
+		}
+
+		var buf bytes.Buffer
+		if err := config.Template.Execute(&buf, log); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("version %d: expected %q, got %q", tt.version, tt.expected, buf.String())
+		}
+	}
+
+	// version 1 is opt-in, not to break the consumers of version 0
+	if o := New(); o.JSONVersion != 0 {
+		t.Errorf("expected version 0 by default, got %d", o.JSONVersion)
+	}
+
+	o := New(WithOutput("json"))
+	o.JSONVersion = stern.JSONVersion + 1
+	if err := o.Validate(); err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
+
+func TestTemplateRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+templates:
+- container: ^app$
+  output: pretty
+- pod: ^nginx-
+  output: raw
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := New(WithColor("never"))
+	o.ConfigFile = path
+	config, err := o.Config("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.TemplateRules) != 2 {
+		t.Fatalf("expected 2 template rules, got %d", len(config.TemplateRules))
+	}
+
+	var buf bytes.Buffer
+	err = config.TemplateRules[0].Template.Execute(&buf, stern.Log{PodName: "api", ContainerName: "app", Message: `{"level":"info"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "api app {\n  \"level\": \"info\"\n}\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if config.TemplateRules[1].PodQuery.String() != "^nginx-" || config.TemplateRules[1].ContainerQuery != nil {
+		t.Errorf("unexpected queries for second rule")
+	}
+
+	for _, output := range []string{"json", "trace"} {
+		o := New(WithColor("never"), WithOutput(output))
+		o.ConfigFile = path
+		config, err := o.Config("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.TemplateRules) != 0 {
+			t.Errorf("expected no template rules with the %s output", output)
+		}
+	}
+
+	err = ioutil.WriteFile(path, []byte("templates:\n- container: app\n  output: json\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Validate(); err == nil {
+		t.Errorf("expected an error for a rule with the json output")
+	}
+
+	err = ioutil.WriteFile(path, []byte("templates:\n- container: app\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Validate(); err == nil {
+		t.Errorf("expected an error for a rule without output or template")
+	}
+}
+
+func TestInCluster(t *testing.T) {
+	defer func(host, kubeconfig string) {
+		os.Setenv("KUBERNETES_SERVICE_HOST", host)
+		os.Setenv("KUBECONFIG", kubeconfig)
+	}(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	os.Unsetenv("KUBECONFIG")
+
+	missing := filepath.Join(os.TempDir(), "stern-missing-kubeconfig")
+	tests := []struct {
+		name     string
+		opts     *Options
+		expected bool
+	}{
+		{"default", New(), true},
+		{"kubeconfig", New(WithKubeConfig(missing)), false},
+		{"context", New(WithContext("staging")), false},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.opts.InCluster(missing); actual != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, actual)
+		}
+	}
+}
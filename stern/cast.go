@@ -0,0 +1,130 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Cast records terminal output in the asciicast v2 format, which can be
+// replayed with asciinema. See
+// https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+type Cast struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	now   func() time.Time
+
+	// pending holds an incomplete UTF-8 sequence until the rest is written
+	pending []byte
+}
+
+// castHeader is the first line of an asciicast
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewCast writes the header of an asciicast of a terminal of the given size
+// to w and returns a writer recording everything written to it as output
+func NewCast(w io.Writer, width, height int) (*Cast, error) {
+	return newCast(w, width, height, time.Now)
+}
+
+func newCast(w io.Writer, width, height int, now func() time.Time) (*Cast, error) {
+	c := &Cast{w: w, start: now(), now: now}
+
+	env := make(map[string]string)
+	for _, name := range []string{"SHELL", "TERM"} {
+		if v := os.Getenv(name); v != "" {
+			env[name] = v
+		}
+	}
+	header, err := json.Marshal(&castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: c.start.Unix(),
+		Env:       env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(header, '\n')); err != nil {
+		return nil, errors.Wrap(err, "failed to write asciicast header")
+	}
+	return c, nil
+}
+
+// Write records p as output at the current time
+func (c *Cast) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := append(c.pending, p...)
+	// JSON strings must be valid UTF-8, keep a sequence split across writes
+	// for the next one
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	c.pending = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return len(p), nil
+	}
+
+	event, err := json.Marshal([]interface{}{
+		c.now().Sub(c.start).Seconds(),
+		"o",
+		onlcr(data[:end]),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.w.Write(append(event, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// onlcr returns p with the line feeds turned into carriage returns and line
+// feeds, as a terminal does for output, so that players start lines at the
+// first column
+func onlcr(p []byte) string {
+	var b strings.Builder
+	for i, c := range p {
+		if c == '\n' && (i == 0 || p[i-1] != '\r') {
+			b.WriteByte('\r')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
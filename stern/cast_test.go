@@ -0,0 +1,67 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCast(t *testing.T) {
+	now := time.Unix(1564653600, 0)
+	clock := func() time.Time { return now }
+
+	var buf bytes.Buffer
+	cast, err := newCast(&buf, 120, 40, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	cast.Write([]byte("\x1b[96mweb-1\x1b[0m app hello\n"))
+	now = now.Add(500 * time.Millisecond)
+	// a rune split across two writes
+	cast.Write([]byte("web-1 › \xe2\x80"))
+	cast.Write([]byte("\xba app\n"))
+	cast.Write([]byte("db-0 › app\r\n"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and 4 events, got %q", lines)
+	}
+
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.Width != 120 || header.Height != 40 || header.Timestamp != 1564653600 {
+		t.Errorf("unexpected header %s", lines[0])
+	}
+
+	expected := []string{
+		`[1.5,"o","\u001b[96mweb-1\u001b[0m app hello\r\n"]`,
+		`[2,"o","web-1 › "]`,
+		`[2,"o","› app\r\n"]`,
+		`[2,"o","db-0 › app\r\n"]`,
+	}
+	for i, e := range expected {
+		if lines[i+1] != e {
+			t.Errorf("event %d: expected %s, got %s", i, e, lines[i+1])
+		}
+	}
+}
@@ -0,0 +1,426 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// CompareOptions configure the comparison of a baseline and a candidate
+type CompareOptions struct {
+	// Window is the time over which the logs of the groups are compared
+	Window time.Duration
+
+	// Interval is the time between two reports
+	Interval time.Duration
+
+	// Threshold is the number of percentage points by which the error rate
+	// of the candidate may exceed the baseline's, negative to never fail
+	Threshold float64
+
+	// MinLines is the number of lines both groups must have logged within
+	// the window before their error rates are judged
+	MinLines int
+}
+
+// GroupStats are the logs of one group within the window
+type GroupStats struct {
+	Containers int
+	Lines      int
+	Errors     int
+
+	// Novel are the message patterns of the group which the other group
+	// never logged, most frequent first
+	Novel []PatternCount
+}
+
+// ErrorRate returns the percentage of lines at error level
+func (s GroupStats) ErrorRate() float64 {
+	if s.Lines == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Lines) * 100
+}
+
+// PatternCount is the number of lines with a message pattern
+type PatternCount struct {
+	Pattern string
+	Count   int
+}
+
+// CompareReport compares the logs of the baseline and the candidate
+type CompareReport struct {
+	Time      time.Time
+	Window    time.Duration
+	Baseline  GroupStats
+	Candidate GroupStats
+
+	// Exceeded is true when the error rate of the candidate exceeds the
+	// baseline's by more than the threshold
+	Exceeded bool
+}
+
+// Delta returns the number of percentage points by which the error rate of
+// the candidate exceeds the baseline's
+func (r *CompareReport) Delta() float64 {
+	return r.Candidate.ErrorRate() - r.Baseline.ErrorRate()
+}
+
+const (
+	baselineGroup = iota
+	candidateGroup
+)
+
+// maxNovelPatterns is the number of novel patterns reported per group
+const maxNovelPatterns = 5
+
+// maxSeenPatterns bounds the patterns remembered per group
+const maxSeenPatterns = 10000
+
+// Compare tails the baseline and the candidate until ctx is done, calling
+// report every interval. It returns the last report, which is returned early
+// when the candidate exceeded the threshold, without passing it to report.
+// Only lines logged from now on are compared.
+func Compare(ctx context.Context, baseline, candidate *Config, opts CompareOptions, report func(*CompareReport)) (*CompareReport, error) {
+	clientset, namespace, err := newClientSet(baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [2]*compareGroup
+	for i, config := range []*Config{baseline, candidate} {
+		config, ns, err := resolve(clientset, namespace, config)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = &compareGroup{config: config, namespace: ns}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := newComparison(opts)
+	var logC [2]chan string
+	for i, g := range groups {
+		logC[i] = make(chan string, 1024)
+		if err := g.start(ctx, clientset, logC[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line := <-logC[baselineGroup]:
+			c.add(baselineGroup, line, time.Now())
+
+		case line := <-logC[candidateGroup]:
+			c.add(candidateGroup, line, time.Now())
+
+		case <-ticker.C:
+			r := c.report(time.Now(), groups[baselineGroup].containers(), groups[candidateGroup].containers())
+			if r.Exceeded {
+				return r, nil
+			}
+			report(r)
+
+		case <-ctx.Done():
+			return c.report(time.Now(), groups[baselineGroup].containers(), groups[candidateGroup].containers()), nil
+		}
+	}
+}
+
+// messageTemplate hands the bare messages to the comparison
+var messageTemplate = template.Must(template.New("message").Parse("{{.Message}}"))
+
+// compareGroup tails the targets of one side of a comparison
+type compareGroup struct {
+	config    *Config
+	namespace string
+
+	mu    sync.Mutex
+	tails map[string]*Tail
+}
+
+// start tails the targets of the group, sending their messages to logC
+func (g *compareGroup) start(ctx context.Context, clientset k8s.Interface, logC chan<- string) error {
+	source := NewKubernetesSource(clientset, g.namespace)
+	added, removed, err := source.Watch(ctx, g.config.targetFilter())
+	if err != nil {
+		return errors.Wrap(err, "failed to set up watch")
+	}
+
+	redact := newRedactors(clientset, g.config)
+	var none int64
+	g.tails = make(map[string]*Tail)
+
+	go func() {
+		for {
+			select {
+			case p, ok := <-added:
+				if !ok {
+					return
+				}
+				id := p.GetID()
+				g.mu.Lock()
+				if existing := g.tails[id]; existing != nil {
+					if existing.Active {
+						g.mu.Unlock()
+						continue
+					}
+					existing.Close()
+				}
+				tail := NewTail(p.Namespace, p.Pod, p.Container, messageTemplate, &TailOptions{
+					SinceSeconds: int64(g.config.Since.Seconds()),
+					Exclude:      g.config.Exclude,
+					Include:      g.config.Include,
+					TailLines:    &none,
+					OnlyLogLines: true,
+					Sidecar:      g.config.sidecarFor(p),
+				})
+				tail.redactors = redact
+				g.tails[id] = tail
+				g.mu.Unlock()
+				tail.StartSource(ctx, source, logC)
+
+			case p, ok := <-removed:
+				if !ok {
+					return
+				}
+				id := p.GetID()
+				g.mu.Lock()
+				if existing := g.tails[id]; existing != nil {
+					existing.Close()
+					delete(g.tails, id)
+				}
+				g.mu.Unlock()
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// containers returns the number of containers tailed
+func (g *compareGroup) containers() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, t := range g.tails {
+		if t.Active {
+			n++
+		}
+	}
+	return n
+}
+
+// comparison counts the lines, errors and message patterns of both groups
+// in buckets of a second
+type comparison struct {
+	opts   CompareOptions
+	groups [2]*groupWindow
+}
+
+type groupWindow struct {
+	buckets []*bucket
+	seen    map[string]bool
+}
+
+type bucket struct {
+	start    time.Time
+	lines    int
+	errors   int
+	patterns map[string]int
+}
+
+func newComparison(opts CompareOptions) *comparison {
+	c := &comparison{opts: opts}
+	for i := range c.groups {
+		c.groups[i] = &groupWindow{seen: make(map[string]bool)}
+	}
+	return c
+}
+
+// add counts a line of a group logged at t
+func (c *comparison) add(group int, line string, t time.Time) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return
+	}
+	g := c.groups[group]
+	start := t.Truncate(time.Second)
+	var b *bucket
+	if n := len(g.buckets); n > 0 && g.buckets[n-1].start.Equal(start) {
+		b = g.buckets[n-1]
+	} else {
+		b = &bucket{start: start, patterns: make(map[string]int)}
+		g.buckets = append(g.buckets, b)
+		c.prune(t)
+	}
+
+	msg, isError := parseLine(line)
+	pattern := messagePattern(msg)
+	b.lines++
+	if isError {
+		b.errors++
+	}
+	b.patterns[pattern]++
+	if len(g.seen) < maxSeenPatterns {
+		g.seen[pattern] = true
+	}
+}
+
+// prune forgets the buckets which left the window at t
+func (c *comparison) prune(t time.Time) {
+	oldest := t.Add(-c.opts.Window)
+	for _, g := range c.groups {
+		i := 0
+		for i < len(g.buckets) && !g.buckets[i].start.After(oldest) {
+			i++
+		}
+		g.buckets = g.buckets[i:]
+	}
+}
+
+// report compares the groups within the window at t
+func (c *comparison) report(t time.Time, baselineContainers, candidateContainers int) *CompareReport {
+	c.prune(t)
+	r := &CompareReport{
+		Time:      t,
+		Window:    c.opts.Window,
+		Baseline:  c.stats(baselineGroup, candidateGroup),
+		Candidate: c.stats(candidateGroup, baselineGroup),
+	}
+	r.Baseline.Containers = baselineContainers
+	r.Candidate.Containers = candidateContainers
+	r.Exceeded = c.opts.Threshold >= 0 &&
+		r.Baseline.Lines >= c.opts.MinLines &&
+		r.Candidate.Lines >= c.opts.MinLines &&
+		r.Delta() > c.opts.Threshold
+	return r
+}
+
+// stats sums the buckets of a group, with the patterns the other group never
+// logged
+func (c *comparison) stats(group, other int) GroupStats {
+	var s GroupStats
+	patterns := make(map[string]int)
+	for _, b := range c.groups[group].buckets {
+		s.Lines += b.lines
+		s.Errors += b.errors
+		for p, n := range b.patterns {
+			if !c.groups[other].seen[p] {
+				patterns[p] += n
+			}
+		}
+	}
+
+	for p, n := range patterns {
+		s.Novel = append(s.Novel, PatternCount{Pattern: p, Count: n})
+	}
+	sort.Slice(s.Novel, func(i, j int) bool {
+		if s.Novel[i].Count != s.Novel[j].Count {
+			return s.Novel[i].Count > s.Novel[j].Count
+		}
+		return s.Novel[i].Pattern < s.Novel[j].Pattern
+	})
+	if len(s.Novel) > maxNovelPatterns {
+		s.Novel = s.Novel[:maxNovelPatterns]
+	}
+	return s
+}
+
+var (
+	// errorLevel matches the level of structured logs, like level=error
+	errorLevel = regexp.MustCompile(`(?i)\b(level|lvl|severity)"?\s*[:=]\s*"?(error|err|fatal|panic|crit|critical|alert|emerg)\b`)
+
+	// errorWord matches an upper case level, a klog header like
+	// E0102 15:04:05.000000 or a Go panic
+	errorWord = regexp.MustCompile(`\b(ERROR|ERR|FATAL|PANIC|CRITICAL|CRIT)\b|^[EF]\d{4} \d\d:\d\d:\d\d|^panic: `)
+)
+
+// parseLine returns the message of a line and whether it was logged at error
+// level. The message of JSON lines is in msg or message.
+func parseLine(line string) (string, bool) {
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil {
+			isError := false
+			for _, key := range []string{"level", "lvl", "severity"} {
+				if level, ok := fields[key].(string); ok {
+					isError = errorLevel.MatchString(key + "=" + level)
+					break
+				}
+			}
+			for _, key := range []string{"msg", "message"} {
+				if msg, ok := fields[key].(string); ok {
+					return msg, isError
+				}
+			}
+			return line, isError
+		}
+	}
+	return line, errorLevel.MatchString(line) || errorWord.MatchString(line)
+}
+
+// patternRules replace the variable parts of messages, in order
+var patternRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`^\S*\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d\S*\s+`), ""},
+	{regexp.MustCompile(`"(?:[^"\\]|\\.)*"`), `"*"`},
+	{regexp.MustCompile(`'(?:[^'\\]|\\.)*'`), `'*'`},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "*"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "*"},
+	{regexp.MustCompile(`(?i)\b(?:0x[0-9a-f]+|[0-9a-f]*\d[0-9a-f]*)\b`), "*"},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?`), "*"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// maxPatternLength truncates long messages, which are rarely repeated as is
+const maxPatternLength = 200
+
+// messagePattern returns the message with its variable parts, like numbers,
+// IDs and quoted strings, replaced by *
+func messagePattern(msg string) string {
+	for _, rule := range patternRules {
+		msg = rule.re.ReplaceAllString(msg, rule.repl)
+	}
+	msg = strings.TrimSpace(msg)
+	if len(msg) > maxPatternLength {
+		n := maxPatternLength
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n]
+	}
+	return msg
+}
@@ -0,0 +1,106 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		msg     string
+		isError bool
+	}{
+		{`level=error msg="connection refused"`, `level=error msg="connection refused"`, true},
+		{`level=info msg="error budget ok"`, `level=info msg="error budget ok"`, false},
+		{`2019-06-20 10:00:00 ERROR failed to connect`, `2019-06-20 10:00:00 ERROR failed to connect`, true},
+		{`E0620 10:00:00.000000       1 reflector.go:125] failed to list`, `E0620 10:00:00.000000       1 reflector.go:125] failed to list`, true},
+		{`panic: runtime error: index out of range`, `panic: runtime error: index out of range`, true},
+		{`{"level":"error","msg":"timeout after 3s"}`, `timeout after 3s`, true},
+		{`{"severity":"INFO","message":"errors: 0"}`, `errors: 0`, false},
+		{`GET /healthz 200`, `GET /healthz 200`, false},
+	}
+
+	for i, tt := range tests {
+		msg, isError := parseLine(tt.line)
+		if msg != tt.msg || isError != tt.isError {
+			t.Errorf("%d: expected %q, %t, got %q, %t", i, tt.msg, tt.isError, msg, isError)
+		}
+	}
+}
+
+func TestMessagePattern(t *testing.T) {
+	tests := []struct {
+		msg      string
+		expected string
+	}{
+		{`2019-06-20T10:00:00.123Z dialing 10.2.3.4:8080 took 12ms`, `dialing * took *ms`},
+		{`user "alice" not found in 'admins'`, `user "*" not found in '*'`},
+		{`request 6fa459ea-ee8a-3ca4-894e-db77e160355e failed with 0xdeadbeef`, `request * failed with *`},
+		{`retrying  in   5s`, `retrying in *s`},
+		{`served v1 api`, `served v1 api`},
+	}
+
+	for i, tt := range tests {
+		if actual := messagePattern(tt.msg); actual != tt.expected {
+			t.Errorf("%d: expected %q, got %q", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestComparison(t *testing.T) {
+	c := newComparison(CompareOptions{Window: time.Minute, Threshold: 5, MinLines: 10})
+	start := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+
+	// lines which leave the window
+	for i := 0; i < 10; i++ {
+		c.add(candidateGroup, "level=error msg=old\n", start)
+	}
+
+	now := start.Add(2 * time.Minute)
+	for i := 0; i < 20; i++ {
+		c.add(baselineGroup, "served request 1", now)
+		c.add(candidateGroup, "served request 2", now)
+	}
+	c.add(baselineGroup, "level=error msg=\"timeout after 3s\"", now)
+	c.add(candidateGroup, "level=error msg=\"timeout after 5s\"", now)
+	c.add(candidateGroup, "ERROR unknown column 7", now)
+	c.add(candidateGroup, "ERROR unknown column 8", now.Add(time.Second))
+
+	r := c.report(now.Add(time.Second), 2, 1)
+	if r.Baseline.Lines != 21 || r.Baseline.Errors != 1 || r.Baseline.Containers != 2 {
+		t.Errorf("unexpected baseline stats %+v", r.Baseline)
+	}
+	if r.Candidate.Lines != 23 || r.Candidate.Errors != 3 || r.Candidate.Containers != 1 {
+		t.Errorf("unexpected candidate stats %+v", r.Candidate)
+	}
+	if len(r.Baseline.Novel) != 0 {
+		t.Errorf("expected no novel baseline patterns, got %v", r.Baseline.Novel)
+	}
+	expected := PatternCount{Pattern: `ERROR unknown column *`, Count: 2}
+	if len(r.Candidate.Novel) != 1 || r.Candidate.Novel[0] != expected {
+		t.Errorf("expected novel candidate pattern %v, got %v", expected, r.Candidate.Novel)
+	}
+	if !r.Exceeded {
+		t.Errorf("expected a delta of %.2f to exceed the threshold", r.Delta())
+	}
+
+	c.opts.MinLines = 100
+	if c.report(now.Add(time.Second), 2, 1).Exceeded {
+		t.Errorf("expected too few lines to be judged")
+	}
+}
@@ -26,8 +26,10 @@ import (
 type Config struct {
 	KubeConfig            string
 	ContextName           string
+	InCluster             bool
 	Namespace             string
 	PodQuery              *regexp.Regexp
+	ResourceQuery         *ResourceQuery
 	Timestamps            bool
 	ContainerQuery        *regexp.Regexp
 	ExcludeContainerQuery *regexp.Regexp
@@ -39,5 +41,51 @@ type Config struct {
 	AllNamespaces         bool
 	LabelSelector         labels.Selector
 	TailLines             *int64
+	TailTotal             *int64
+	LimitBytes            *int64
+	MaxLogRequests        int
 	Template              *template.Template
+	TemplateRules         []TemplateRule
+	Backoff               Backoff
+	RedactSecrets         bool
+	Envelope              bool
+	Cluster               string
+	Hooks                 []Hook
+	HookLimits            HookLimits
+	Sidecars              string
+	JournalUnits          []string
+	JournalFiles          []string
+	LocalFiles            []string
+	Headers               bool
+	Trace                 bool
+	OnlyLogLines          bool
+
+	// ConfirmVolume is asked with the estimated volume of logs, or the error
+	// estimating it, before they are fetched when set. Returning false stops
+	// with ErrDeclined.
+	ConfirmVolume func(*VolumeEstimate, error) bool
+}
+
+// TemplateRule selects the template of the containers matching its queries
+// instead of the default template
+type TemplateRule struct {
+	// PodQuery and ContainerQuery match every pod or container when nil
+	PodQuery       *regexp.Regexp
+	ContainerQuery *regexp.Regexp
+	Template       *template.Template
+}
+
+// templateFor returns the template of the first rule matching a target, or
+// the default template
+func (c *Config) templateFor(t *Target) *template.Template {
+	for _, rule := range c.TemplateRules {
+		if rule.PodQuery != nil && !rule.PodQuery.MatchString(t.Pod) {
+			continue
+		}
+		if rule.ContainerQuery != nil && !rule.ContainerQuery.MatchString(t.Container) {
+			continue
+		}
+		return rule.Template
+	}
+	return c.Template
 }
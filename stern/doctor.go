@@ -0,0 +1,461 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/wercker/stern/kubernetes"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/version"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Statuses of a doctor check
+const (
+	DoctorOK   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+	DoctorSkip = "skip"
+)
+
+// maxClockSkew is the clock skew with the API server above which --since
+// and timestamps become misleading
+const maxClockSkew = 5 * time.Second
+
+// DoctorCheck is the result of a check of the environment
+type DoctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+
+	// Fix tells how to fix a failure or a warning
+	Fix string
+}
+
+// doctor holds what the checks found for the following checks
+type doctor struct {
+	config       *Config
+	clientConfig clientcmd.ClientConfig
+	raw          clientcmdapi.Config
+	context      string
+	namespace    string
+	restConfig   *rest.Config
+	response     *http.Response
+}
+
+// Doctor checks that stern can tail config in this environment, reporting
+// every check as it completes. Checks depending on a failed one are skipped.
+func Doctor(ctx context.Context, config *Config, report func(*DoctorCheck)) []*DoctorCheck {
+	d := &doctor{config: config}
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) *DoctorCheck
+	}{
+		{"kubeconfig", d.checkKubeConfig},
+		{"context", d.checkContext},
+		{"auth plugin", d.checkAuthPlugin},
+		{"api server", d.checkAPIServer},
+		{"rbac", d.checkRBAC},
+		{"http/2", d.checkHTTP2},
+		{"clock", d.checkClock},
+		{"colors", d.checkColors},
+	}
+
+	var results []*DoctorCheck
+	failed := false
+	for _, c := range checks {
+		var check *DoctorCheck
+		if failed && c.name != "colors" {
+			check = &DoctorCheck{Status: DoctorSkip, Detail: "skipped after a failure"}
+		} else {
+			check = c.run(ctx)
+		}
+		check.Name = c.name
+		if check.Status == DoctorFail {
+			failed = true
+		}
+		results = append(results, check)
+		if report != nil {
+			report(check)
+		}
+	}
+
+	if d.response != nil {
+		d.response.Body.Close()
+	}
+	return results
+}
+
+func (d *doctor) checkKubeConfig(context.Context) *DoctorCheck {
+	if d.config.InCluster {
+		restConfig, err := kubernetes.InClusterConfig()
+		if err != nil {
+			return &DoctorCheck{
+				Status: DoctorFail,
+				Detail: err.Error(),
+				Fix:    "Mount the token of the service account in the pod, or point --kubeconfig or KUBECONFIG to a kubeconfig",
+			}
+		}
+		d.restConfig = restConfig
+		return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("%s not found, using the service account of the pod", d.config.KubeConfig)}
+	}
+
+	var found []string
+	for _, path := range filepath.SplitList(d.config.KubeConfig) {
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	if len(found) == 0 {
+		return &DoctorCheck{
+			Status: DoctorFail,
+			Detail: fmt.Sprintf("%s not found", d.config.KubeConfig),
+			Fix:    "Point --kubeconfig or KUBECONFIG to your kubeconfig, or write one with your cluster's CLI, like 'gcloud container clusters get-credentials' or 'aws eks update-kubeconfig'",
+		}
+	}
+
+	d.clientConfig = kubernetes.NewClientConfig(d.config.KubeConfig, d.config.ContextName)
+	raw, err := d.clientConfig.RawConfig()
+	if err != nil {
+		return &DoctorCheck{
+			Status: DoctorFail,
+			Detail: err.Error(),
+			Fix:    fmt.Sprintf("Fix the syntax of %s, 'kubectl config view' shows where it breaks", strings.Join(found, ", ")),
+		}
+	}
+	d.raw = raw
+	return &DoctorCheck{Status: DoctorOK, Detail: strings.Join(found, ", ")}
+}
+
+func (d *doctor) checkContext(context.Context) *DoctorCheck {
+	if d.config.InCluster {
+		d.namespace = d.config.Namespace
+		if d.namespace == "" {
+			d.namespace = kubernetes.InClusterNamespace()
+		}
+		if d.config.AllNamespaces {
+			d.namespace = ""
+			return &DoctorCheck{Status: DoctorOK, Detail: "in-cluster, all namespaces"}
+		}
+		return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("in-cluster, namespace %s", d.namespace)}
+	}
+
+	d.context = d.raw.CurrentContext
+	if d.config.ContextName != "" {
+		d.context = d.config.ContextName
+	}
+
+	var names []string
+	for name := range d.raw.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c, ok := d.raw.Contexts[d.context]
+	if d.context == "" || !ok {
+		check := &DoctorCheck{Status: DoctorFail, Detail: fmt.Sprintf("context %q not found", d.context)}
+		if d.context == "" {
+			check.Detail = "no current context"
+		}
+		check.Fix = "Pick a context with --context or 'kubectl config use-context'"
+		if len(names) > 0 {
+			check.Fix += ", one of " + strings.Join(names, ", ")
+		}
+		return check
+	}
+	if _, ok := d.raw.Clusters[c.Cluster]; !ok {
+		return &DoctorCheck{
+			Status: DoctorFail,
+			Detail: fmt.Sprintf("cluster %q of context %q not found", c.Cluster, d.context),
+			Fix:    fmt.Sprintf("Add the cluster with 'kubectl config set-cluster %s --server=...' or fix the context", c.Cluster),
+		}
+	}
+
+	var err error
+	d.namespace, _, err = d.clientConfig.Namespace()
+	if err != nil {
+		return &DoctorCheck{Status: DoctorFail, Detail: err.Error(), Fix: "Fix the namespace of the context"}
+	}
+	if d.config.Namespace != "" {
+		d.namespace = d.config.Namespace
+	}
+
+	detail := fmt.Sprintf("context %s, namespace %s", d.context, d.namespace)
+	if d.config.AllNamespaces {
+		d.namespace = ""
+		detail = fmt.Sprintf("context %s, all namespaces", d.context)
+	}
+	return &DoctorCheck{Status: DoctorOK, Detail: detail}
+}
+
+func (d *doctor) checkAuthPlugin(ctx context.Context) *DoctorCheck {
+	if d.config.InCluster {
+		return &DoctorCheck{Status: DoctorSkip, Detail: "in-cluster, using the service account token"}
+	}
+	user := d.raw.AuthInfos[d.raw.Contexts[d.context].AuthInfo]
+	switch {
+	case user == nil:
+		return &DoctorCheck{Status: DoctorSkip, Detail: "no user in the context"}
+	case user.Exec != nil:
+		path, err := exec.LookPath(user.Exec.Command)
+		if err != nil {
+			return &DoctorCheck{
+				Status: DoctorFail,
+				Detail: fmt.Sprintf("%s not found", user.Exec.Command),
+				Fix:    fmt.Sprintf("Install %s or add its directory to PATH, the context runs it to get credentials", user.Exec.Command),
+			}
+		}
+		if stderr, err := runExecPlugin(ctx, user.Exec); err != nil {
+			detail := err.Error()
+			if stderr != "" {
+				detail += ": " + stderr
+			}
+			return &DoctorCheck{
+				Status: DoctorFail,
+				Detail: detail,
+				Fix:    fmt.Sprintf("Run %s to see why it fails, its credentials may have expired and need a new login", strings.Join(append([]string{user.Exec.Command}, user.Exec.Args...), " ")),
+			}
+		}
+		return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("%s returned credentials", path)}
+	case user.AuthProvider != nil:
+		switch user.AuthProvider.Name {
+		case "gcp", "azure", "oidc":
+			return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("%s auth provider", user.AuthProvider.Name)}
+		default:
+			return &DoctorCheck{
+				Status: DoctorFail,
+				Detail: fmt.Sprintf("unsupported auth provider %q", user.AuthProvider.Name),
+				Fix:    "Switch the user of the context to an exec credential plugin",
+			}
+		}
+	default:
+		return &DoctorCheck{Status: DoctorSkip, Detail: "no plugin, using static credentials"}
+	}
+}
+
+// execCredential is the part of the output of an exec credential plugin
+// which is checked
+type execCredential struct {
+	APIVersion string `json:"apiVersion"`
+	Status     *struct {
+		Token                 string `json:"token"`
+		ClientCertificateData string `json:"clientCertificateData"`
+		ClientKeyData         string `json:"clientKeyData"`
+	} `json:"status"`
+}
+
+// runExecPlugin runs an exec credential plugin the way client-go does and
+// checks that it prints credentials. It returns the stderr of the plugin,
+// which tells why it failed.
+func runExecPlugin(ctx context.Context, c *clientcmdapi.ExecConfig) (string, error) {
+	interactive := isatty.IsTerminal(os.Stdin.Fd())
+
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range c.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	if c.APIVersion == "client.authentication.k8s.io/v1alpha1" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf(`KUBERNETES_EXEC_INFO={"apiVersion":%q,"kind":"ExecCredential","spec":{"interactive":%t}}`, c.APIVersion, interactive))
+	}
+	if interactive {
+		cmd.Stdin = os.Stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return strings.TrimSpace(stderr.String()), errors.Wrapf(err, "%s failed", c.Command)
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return strings.TrimSpace(stderr.String()), errors.Wrapf(err, "%s printed no ExecCredential", c.Command)
+	}
+	switch {
+	case cred.APIVersion != c.APIVersion:
+		return "", errors.Errorf("%s printed %s credentials, the context expects %s", c.Command, cred.APIVersion, c.APIVersion)
+	case cred.Status == nil || (cred.Status.Token == "" && cred.Status.ClientCertificateData == ""):
+		return "", errors.Errorf("%s printed no token or client certificate", c.Command)
+	case (cred.Status.ClientCertificateData == "") != (cred.Status.ClientKeyData == ""):
+		return "", errors.Errorf("%s printed a client certificate without its key, or a key without its certificate", c.Command)
+	}
+	return "", nil
+}
+
+func (d *doctor) checkAPIServer(ctx context.Context) *DoctorCheck {
+	restConfig := d.restConfig
+	if restConfig == nil {
+		var err error
+		restConfig, err = d.clientConfig.ClientConfig()
+		if err != nil {
+			return &DoctorCheck{Status: DoctorFail, Detail: err.Error(), Fix: "Fix the cluster and user of the context"}
+		}
+	}
+	restConfig.Timeout = 10 * time.Second
+	d.restConfig = restConfig
+
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return &DoctorCheck{Status: DoctorFail, Detail: err.Error(), Fix: "Fix the certificates of the cluster and user of the context"}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(restConfig.Host, "/")+"/version", nil)
+	if err != nil {
+		return &DoctorCheck{Status: DoctorFail, Detail: err.Error(), Fix: "Fix the server URL of the cluster"}
+	}
+	client := &http.Client{Transport: transport, Timeout: restConfig.Timeout}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		fix := fmt.Sprintf("Check that %s is reachable from here, through a VPN or a bastion if needed, and that the cluster is running", restConfig.Host)
+		if strings.Contains(err.Error(), "x509") {
+			fix = "Update the certificate authority of the cluster in the kubeconfig, it doesn't match the server's certificate"
+		} else if strings.Contains(err.Error(), "getting credentials") {
+			fix = "Run the credential plugin of the context by hand to see why it fails, often an expired login"
+		}
+		return &DoctorCheck{Status: DoctorFail, Detail: err.Error(), Fix: fix}
+	}
+	d.response = resp
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &DoctorCheck{
+			Status: DoctorFail,
+			Detail: fmt.Sprintf("%s rejected the credentials", restConfig.Host),
+			Fix:    "Log in again or refresh the credentials of the context, they are invalid or expired",
+		}
+	}
+
+	var info version.Info
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &info); err != nil || info.GitVersion == "" {
+		return &DoctorCheck{Status: DoctorWarn, Detail: fmt.Sprintf("%s answered %s without a version", restConfig.Host, resp.Status)}
+	}
+	return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("%s, Kubernetes %s", restConfig.Host, info.GitVersion)}
+}
+
+func (d *doctor) checkRBAC(context.Context) *DoctorCheck {
+	clientset, err := k8s.NewForConfig(d.restConfig)
+	if err != nil {
+		return &DoctorCheck{Status: DoctorFail, Detail: err.Error()}
+	}
+
+	var denied []string
+	for _, attr := range rbacChecks(d.namespace) {
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attr},
+		})
+		if err != nil {
+			return &DoctorCheck{Status: DoctorWarn, Detail: errors.Wrap(err, "failed to review access").Error()}
+		}
+		if !review.Status.Allowed {
+			name := attr.Resource
+			if attr.Subresource != "" {
+				name += "/" + attr.Subresource
+			}
+			denied = append(denied, attr.Verb+" "+name)
+		}
+	}
+
+	where := "namespace " + d.namespace
+	if d.namespace == "" {
+		where = "all namespaces"
+	}
+	if len(denied) > 0 {
+		return &DoctorCheck{
+			Status: DoctorFail,
+			Detail: fmt.Sprintf("denied %s in %s", strings.Join(denied, ", "), where),
+			Fix:    "Ask a cluster admin to apply the output of 'stern rbac' with the same flags",
+		}
+	}
+	return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("can watch pods and get their logs in %s", where)}
+}
+
+// rbacChecks returns the access reviewed by the rbac check
+func rbacChecks(namespace string) []authorizationv1.ResourceAttributes {
+	return []authorizationv1.ResourceAttributes{
+		{Namespace: namespace, Verb: "list", Resource: "pods"},
+		{Namespace: namespace, Verb: "watch", Resource: "pods"},
+		{Namespace: namespace, Verb: "get", Resource: "pods", Subresource: "log"},
+	}
+}
+
+func (d *doctor) checkHTTP2(context.Context) *DoctorCheck {
+	if d.response.ProtoMajor >= 2 {
+		return &DoctorCheck{Status: DoctorOK, Detail: d.response.Proto}
+	}
+	return &DoctorCheck{
+		Status: DoctorWarn,
+		Detail: fmt.Sprintf("%s instead of HTTP/2", d.response.Proto),
+		Fix:    "Every container followed holds its own connection, check that the proxies between here and the API server allow HTTP/2",
+	}
+}
+
+func (d *doctor) checkClock(context.Context) *DoctorCheck {
+	date, err := http.ParseTime(d.response.Header.Get("Date"))
+	if err != nil {
+		return &DoctorCheck{Status: DoctorSkip, Detail: "the API server didn't send its time"}
+	}
+
+	// the Date header is truncated to the second
+	skew := time.Since(date) - 500*time.Millisecond
+	if skew < 0 {
+		skew = -skew
+	}
+	skew = skew.Round(time.Second)
+	if skew > maxClockSkew {
+		return &DoctorCheck{
+			Status: DoctorWarn,
+			Detail: fmt.Sprintf("%s off the API server", skew),
+			Fix:    "Synchronize the clock with NTP, --since and the timestamps of the logs are off by as much",
+		}
+	}
+	return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("within %s of the API server", maxClockSkew)}
+}
+
+func (d *doctor) checkColors(context.Context) *DoctorCheck {
+	term := os.Getenv("TERM")
+	switch {
+	case !isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()):
+		if color.NoColor {
+			return &DoctorCheck{Status: DoctorOK, Detail: "not a terminal, no colors"}
+		}
+		return &DoctorCheck{Status: DoctorOK, Detail: "not a terminal, colors forced"}
+	case term == "dumb":
+		return &DoctorCheck{Status: DoctorWarn, Detail: "TERM=dumb disables colors", Fix: "Set TERM to your terminal, like xterm-256color, or pass --color always"}
+	case color.NoColor:
+		return &DoctorCheck{Status: DoctorOK, Detail: "colors disabled by --color"}
+	default:
+		return &DoctorCheck{Status: DoctorOK, Detail: fmt.Sprintf("colors enabled, TERM=%s", term)}
+	}
+}
@@ -0,0 +1,215 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wercker/stern/kubernetes"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/rest"
+)
+
+// newDoctorServer returns an API server denying the subresources in denied
+// and whose clock is off by skew
+func newDoctorServer(t *testing.T, denied map[string]bool, skew time.Duration) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			fmt.Fprint(w, `{"gitVersion": "v1.15.0"}`)
+		case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			var review authorizationv1.SelfSubjectAccessReview
+			if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+				t.Error(err)
+			}
+			review.Status.Allowed = !denied[review.Spec.ResourceAttributes.Subresource]
+			json.NewEncoder(w).Encode(&review)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+// writeDoctorKubeConfig writes a kubeconfig for server whose user is the
+// YAML of user
+func writeDoctorKubeConfig(t *testing.T, server, user string) string {
+	dir, err := ioutil.TempDir("", "stern-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: test
+  context: {cluster: test, user: test, namespace: prod}
+clusters:
+- name: test
+  cluster: {server: %q, insecure-skip-tls-verify: true}
+users:
+- name: test
+  user: %s
+`, server, user)
+	if err := ioutil.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDoctor(t *testing.T) {
+	tests := []struct {
+		name     string
+		context  string
+		denied   map[string]bool
+		skew     time.Duration
+		expected map[string]string
+	}{
+		{
+			"healthy",
+			"",
+			nil,
+			0,
+			map[string]string{"kubeconfig": DoctorOK, "context": DoctorOK, "auth plugin": DoctorSkip, "api server": DoctorOK, "rbac": DoctorOK, "http/2": DoctorOK, "clock": DoctorOK},
+		},
+		{
+			"logs denied",
+			"",
+			map[string]bool{"log": true},
+			0,
+			map[string]string{"api server": DoctorOK, "rbac": DoctorFail, "http/2": DoctorSkip, "clock": DoctorSkip},
+		},
+		{
+			"clock skew",
+			"",
+			nil,
+			-time.Minute,
+			map[string]string{"rbac": DoctorOK, "clock": DoctorWarn},
+		},
+		{
+			"unknown context",
+			"staging",
+			nil,
+			0,
+			map[string]string{"kubeconfig": DoctorOK, "context": DoctorFail, "api server": DoctorSkip},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newDoctorServer(t, tt.denied, tt.skew)
+			defer ts.Close()
+			kubeconfig := writeDoctorKubeConfig(t, ts.URL, "{token: secret}")
+			defer os.RemoveAll(filepath.Dir(kubeconfig))
+
+			config := &Config{KubeConfig: kubeconfig, ContextName: tt.context}
+			checks := make(map[string]*DoctorCheck)
+			for _, check := range Doctor(context.Background(), config, nil) {
+				checks[check.Name] = check
+			}
+
+			for name, status := range tt.expected {
+				if check := checks[name]; check == nil || check.Status != status {
+					t.Errorf("expected %s to be %s, got %+v", name, status, check)
+				}
+			}
+			if len(checks) != 8 {
+				t.Errorf("expected 8 checks, got %d", len(checks))
+			}
+		})
+	}
+}
+
+func TestDoctorExecPlugin(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		status   string
+		contains string
+	}{
+		{"credentials", `echo '{"apiVersion": "client.authentication.k8s.io/v1beta1", "kind": "ExecCredential", "status": {"token": "secret"}}'`, DoctorOK, "returned credentials"},
+		{"expired login", `echo 'the SSO session has expired' >&2; exit 1`, DoctorFail, "the SSO session has expired"},
+		{"no credentials", `echo '{"apiVersion": "client.authentication.k8s.io/v1beta1", "kind": "ExecCredential", "status": {}}'`, DoctorFail, "no token"},
+	}
+
+	ts := newDoctorServer(t, nil, 0)
+	defer ts.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := json.Marshal(map[string]interface{}{
+				"exec": map[string]interface{}{
+					"apiVersion": "client.authentication.k8s.io/v1beta1",
+					"command":    "sh",
+					"args":       []string{"-c", tt.script},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			kubeconfig := writeDoctorKubeConfig(t, ts.URL, string(user))
+			defer os.RemoveAll(filepath.Dir(kubeconfig))
+
+			var check *DoctorCheck
+			for _, c := range Doctor(context.Background(), &Config{KubeConfig: kubeconfig}, nil) {
+				if c.Name == "auth plugin" {
+					check = c
+				}
+			}
+			if check == nil || check.Status != tt.status || !strings.Contains(check.Detail, tt.contains) {
+				t.Errorf("expected the auth plugin check to be %s with %q, got %+v", tt.status, tt.contains, check)
+			}
+		})
+	}
+}
+
+func TestDoctorInCluster(t *testing.T) {
+	ts := newDoctorServer(t, nil, 0)
+	defer ts.Close()
+
+	defer func(config func() (*rest.Config, error)) {
+		kubernetes.InClusterConfig = config
+	}(kubernetes.InClusterConfig)
+	kubernetes.InClusterConfig = func() (*rest.Config, error) {
+		return &rest.Config{Host: ts.URL, BearerToken: "secret", TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, nil
+	}
+
+	config := &Config{KubeConfig: filepath.Join(os.TempDir(), "stern-doctor-missing"), InCluster: true, Namespace: "prod"}
+	checks := make(map[string]*DoctorCheck)
+	for _, check := range Doctor(context.Background(), config, nil) {
+		checks[check.Name] = check
+	}
+
+	expected := map[string]string{"kubeconfig": DoctorOK, "context": DoctorOK, "auth plugin": DoctorSkip, "api server": DoctorOK, "rbac": DoctorOK}
+	for name, status := range expected {
+		if check := checks[name]; check == nil || check.Status != status {
+			t.Errorf("expected %s to be %s, got %+v", name, status, check)
+		}
+	}
+}
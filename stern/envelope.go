@@ -0,0 +1,206 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JSONVersion is the latest version of the JSON output
+const JSONVersion = 1
+
+// Types of the records of the JSON output
+const (
+	EventLog     = "log"
+	EventAdded   = "added"
+	EventRemoved = "removed"
+)
+
+// EnvelopeV1 is a record of version 1 of the JSON output, see JSONSchema
+type EnvelopeV1 struct {
+	Version   int                    `json:"version"`
+	Type      string                 `json:"type"`
+	Timestamp string                 `json:"timestamp,omitempty"`
+	Cluster   string                 `json:"cluster,omitempty"`
+	Namespace string                 `json:"namespace"`
+	Pod       string                 `json:"pod"`
+	Container string                 `json:"container"`
+	Node      string                 `json:"node,omitempty"`
+	Stream    string                 `json:"stream,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// envelopeV0 is the JSON output from before it was versioned, which was Log
+// marshaled as is
+type envelopeV0 struct {
+	Message       string `json:"message"`
+	Namespace     string `json:"namespace"`
+	PodName       string `json:"podName"`
+	ContainerName string `json:"containerName"`
+}
+
+// Envelope returns the record of the JSON output of version for a log
+func Envelope(version int, log Log) (interface{}, error) {
+	switch version {
+	case 0:
+		return &envelopeV0{
+			Message:       log.Message,
+			Namespace:     log.Namespace,
+			PodName:       log.PodName,
+			ContainerName: log.ContainerName,
+		}, nil
+	case 1:
+		e := &EnvelopeV1{
+			Version:   1,
+			Type:      log.Event,
+			Timestamp: log.Timestamp,
+			Cluster:   log.Cluster,
+			Namespace: log.Namespace,
+			Pod:       log.PodName,
+			Container: log.ContainerName,
+			Node:      log.NodeName,
+			Stream:    log.Stream,
+			Message:   strings.TrimRight(log.Message, "\r\n"),
+		}
+		if e.Type == "" {
+			e.Type = EventLog
+			e.Fields = parseFields(e.Message)
+		}
+		return e, nil
+	default:
+		return nil, errors.Errorf("unknown JSON output version %d", version)
+	}
+}
+
+// MarshalEnvelope returns the record of the JSON output of version for a log
+// as a string
+func MarshalEnvelope(version int, log Log) (string, error) {
+	e, err := Envelope(version, log)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// parseFields returns the fields of a message which is a JSON object
+func parseFields(msg string) map[string]interface{} {
+	if !strings.HasPrefix(strings.TrimSpace(msg), "{") {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// JSONSchema returns the JSON schema of version of the JSON output
+func JSONSchema(version int) (string, error) {
+	switch version {
+	case 0:
+		return jsonSchemaV0, nil
+	case 1:
+		return jsonSchemaV1, nil
+	default:
+		return "", errors.Errorf("unknown JSON output version %d, the latest is %d", version, JSONVersion)
+	}
+}
+
+const jsonSchemaV0 = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/wercker/stern/schema/v0.json",
+  "title": "stern JSON output, version 0",
+  "description": "A log line, as printed by stern -o json before the output was versioned. Every line of the output is one record.",
+  "type": "object",
+  "required": ["message", "namespace", "podName", "containerName"],
+  "properties": {
+    "message": {
+      "description": "The log line, including its trailing newline and, with --timestamps, its timestamp",
+      "type": "string"
+    },
+    "namespace": {
+      "type": "string"
+    },
+    "podName": {
+      "type": "string"
+    },
+    "containerName": {
+      "type": "string"
+    }
+  }
+}
+`
+
+const jsonSchemaV1 = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/wercker/stern/schema/v1.json",
+  "title": "stern JSON output, version 1",
+  "description": "A log line or a lifecycle event of a container. Every line of the output is one record. Fields may be added to this version, but never removed or changed.",
+  "type": "object",
+  "required": ["version", "type", "namespace", "pod", "container"],
+  "properties": {
+    "version": {
+      "description": "The version of the output",
+      "const": 1
+    },
+    "type": {
+      "description": "log for a log line, added when stern starts tailing a container and removed when it stops",
+      "enum": ["log", "added", "removed"]
+    },
+    "timestamp": {
+      "description": "When the line was logged, in RFC 3339 format with nanoseconds",
+      "type": "string",
+      "format": "date-time"
+    },
+    "cluster": {
+      "description": "The name of the cluster of the Kubernetes context",
+      "type": "string"
+    },
+    "namespace": {
+      "type": "string"
+    },
+    "pod": {
+      "type": "string"
+    },
+    "container": {
+      "type": "string"
+    },
+    "node": {
+      "description": "The node the pod runs on, when it is scheduled",
+      "type": "string"
+    },
+    "stream": {
+      "description": "stdout or stderr, when the source of the logs tells them apart. Kubernetes logs don't.",
+      "enum": ["stdout", "stderr"]
+    },
+    "message": {
+      "description": "The log line without its trailing newline",
+      "type": "string"
+    },
+    "fields": {
+      "description": "The fields of the message, when it is a JSON object",
+      "type": "object"
+    }
+  }
+}
+`
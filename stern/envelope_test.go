@@ -0,0 +1,103 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalEnvelope(t *testing.T) {
+	log := Log{
+		Message:       `{"level":"error","status":500}` + "\n",
+		Namespace:     "ns",
+		PodName:       "web-1",
+		ContainerName: "app",
+		NodeName:      "node1",
+		Cluster:       "prod",
+		Timestamp:     "2019-08-01T10:00:00.123456789Z",
+	}
+
+	tests := []struct {
+		version  int
+		log      Log
+		expected string
+	}{
+		{
+			0,
+			log,
+			`{"message":"{\"level\":\"error\",\"status\":500}\n","namespace":"ns","podName":"web-1","containerName":"app"}`,
+		},
+		{
+			1,
+			log,
+			`{"version":1,"type":"log","timestamp":"2019-08-01T10:00:00.123456789Z","cluster":"prod","namespace":"ns","pod":"web-1","container":"app","node":"node1","message":"{\"level\":\"error\",\"status\":500}","fields":{"level":"error","status":500}}`,
+		},
+		{
+			1,
+			Log{Message: "plain {text}\n", Namespace: "ns", PodName: "web-1", ContainerName: "app"},
+			`{"version":1,"type":"log","namespace":"ns","pod":"web-1","container":"app","message":"plain {text}"}`,
+		},
+		{
+			1,
+			Log{Namespace: "ns", PodName: "web-1", ContainerName: "app", Event: EventAdded},
+			`{"version":1,"type":"added","namespace":"ns","pod":"web-1","container":"app"}`,
+		},
+	}
+
+	for i, tt := range tests {
+		actual, err := MarshalEnvelope(tt.version, tt.log)
+		if err != nil {
+			t.Errorf("%d: unexpected error %s", i, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("%d: expected %s, got %s", i, tt.expected, actual)
+		}
+	}
+
+	if _, err := MarshalEnvelope(JSONVersion+1, log); err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
+
+func TestMarshalLog(t *testing.T) {
+	// {{json .}} in templates prints the unversioned output
+	log := Log{Message: "hello\n", Namespace: "ns", PodName: "web-1", ContainerName: "app", NodeName: "node1", Cluster: "prod", Stream: "stderr"}
+	b, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v0, err := MarshalEnvelope(0, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != v0 {
+		t.Errorf("expected %s, got %s", v0, b)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	for version := 0; version <= JSONVersion; version++ {
+		schema, err := JSONSchema(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s map[string]interface{}
+		if err := json.Unmarshal([]byte(schema), &s); err != nil {
+			t.Errorf("schema of version %d isn't valid JSON: %s", version, err)
+		}
+	}
+}
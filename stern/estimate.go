@@ -0,0 +1,158 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// ErrDeclined is returned when Config.ConfirmVolume declines fetching the logs
+var ErrDeclined = errors.New("fetching the logs was declined")
+
+// VolumeEstimate is an estimation of the amount of logs a config would fetch
+type VolumeEstimate struct {
+	// Bytes is the size of the current log files of the containers, capped by
+	// the byte limit per container
+	Bytes int64
+
+	// Containers is the number of matched containers
+	Containers int
+
+	// Unknown is the number of containers whose log size couldn't be read
+	Unknown int
+}
+
+// Exceeds returns true when the estimate is above threshold, or when the log
+// size of most containers is unknown and the estimate can't tell
+func (e *VolumeEstimate) Exceeds(threshold int64) bool {
+	return e.Bytes > threshold || e.Unknown*2 > e.Containers
+}
+
+// statsSummary is the part of the kubelet stats summary holding log usage
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name string `json:"name"`
+			Logs *struct {
+				UsedBytes *int64 `json:"usedBytes"`
+			} `json:"logs"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+// confirmVolume asks config.ConfirmVolume, when set, whether to fetch the
+// estimated logs of the resolved config and returns ErrDeclined otherwise
+func confirmVolume(clientset k8s.Interface, namespace string, config *Config) error {
+	if config.ConfirmVolume == nil {
+		return nil
+	}
+	if !config.ConfirmVolume(kubernetesVolume(clientset, namespace, config)) {
+		return ErrDeclined
+	}
+	return nil
+}
+
+// kubernetesVolume estimates how much logs a resolved config would fetch,
+// using the log usage reported by the kubelets through the node proxy
+func kubernetesVolume(clientset k8s.Interface, namespace string, config *Config) (*VolumeEstimate, error) {
+	targets, err := List(clientset.CoreV1().Pods(namespace),
+		config.PodQuery,
+		config.ContainerQuery,
+		config.ExcludeContainerQuery,
+		config.InitContainers,
+		config.ContainerState,
+		config.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	return estimateVolume(targets, config.LimitBytes, func(node string) ([]byte, error) {
+		return clientset.CoreV1().RESTClient().Get().
+			Resource("nodes").
+			Name(node).
+			SubResource("proxy").
+			Suffix("stats/summary").
+			Do().
+			Raw()
+	}), nil
+}
+
+// estimateVolume sums the log usage of the targets from the stats summary of
+// their nodes, fetched with summary
+func estimateVolume(targets []*Target, limitBytes *int64, summary func(node string) ([]byte, error)) *VolumeEstimate {
+	estimate := &VolumeEstimate{Containers: len(targets)}
+
+	usage := make(map[string]int64)
+	fetched := make(map[string]bool)
+	for _, t := range targets {
+		if t.Node == "" || fetched[t.Node] {
+			continue
+		}
+		fetched[t.Node] = true
+
+		raw, err := summary(t.Node)
+		if err != nil {
+			continue
+		}
+		var s statsSummary
+		if err := json.Unmarshal(raw, &s); err != nil {
+			continue
+		}
+		for _, p := range s.Pods {
+			for _, c := range p.Containers {
+				if c.Logs != nil && c.Logs.UsedBytes != nil {
+					id := (&Target{Namespace: p.PodRef.Namespace, Pod: p.PodRef.Name, Container: c.Name}).GetID()
+					usage[id] = *c.Logs.UsedBytes
+				}
+			}
+		}
+	}
+
+	for _, t := range targets {
+		used, ok := usage[t.GetID()]
+		if !ok {
+			estimate.Unknown++
+			continue
+		}
+		if limitBytes != nil && used > *limitBytes {
+			used = *limitBytes
+		}
+		estimate.Bytes += used
+	}
+
+	return estimate
+}
+
+// FormatBytes formats a number of bytes for humans
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,110 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestEstimateVolume(t *testing.T) {
+	summaries := map[string]string{
+		"node1": `{"pods": [
+			{"podRef": {"name": "web-1", "namespace": "ns"}, "containers": [
+				{"name": "app", "logs": {"usedBytes": 1000}},
+				{"name": "proxy", "logs": {"usedBytes": 5000}}
+			]},
+			{"podRef": {"name": "db-1", "namespace": "ns"}, "containers": [
+				{"name": "db", "logs": {"usedBytes": 9999}}
+			]}
+		]}`,
+		"node2": `{"pods": [
+			{"podRef": {"name": "web-2", "namespace": "ns"}, "containers": [
+				{"name": "app"}
+			]}
+		]}`,
+	}
+	calls := map[string]int{}
+	summary := func(node string) ([]byte, error) {
+		calls[node]++
+		s, ok := summaries[node]
+		if !ok {
+			return nil, errors.New("forbidden")
+		}
+		return []byte(s), nil
+	}
+
+	targets := []*Target{
+		{Node: "node1", Namespace: "ns", Pod: "web-1", Container: "app"},
+		{Node: "node1", Namespace: "ns", Pod: "web-1", Container: "proxy"},
+		{Node: "node2", Namespace: "ns", Pod: "web-2", Container: "app"},
+		{Node: "node3", Namespace: "ns", Pod: "web-3", Container: "app"},
+		{Namespace: "ns", Pod: "pending", Container: "app"},
+	}
+
+	e := estimateVolume(targets, nil, summary)
+	if e.Bytes != 6000 || e.Containers != 5 || e.Unknown != 3 {
+		t.Errorf("unexpected estimate %+v", e)
+	}
+	if calls["node1"] != 1 {
+		t.Errorf("expected the summary of node1 to be fetched once, got %d", calls["node1"])
+	}
+
+	limit := int64(2000)
+	e = estimateVolume(targets, &limit, summary)
+	if e.Bytes != 3000 {
+		t.Errorf("expected 3000 bytes with a limit, got %d", e.Bytes)
+	}
+}
+
+func TestVolumeEstimateExceeds(t *testing.T) {
+	tests := []struct {
+		estimate VolumeEstimate
+		expected bool
+	}{
+		{VolumeEstimate{Bytes: 100, Containers: 4}, false},
+		{VolumeEstimate{Bytes: 2000, Containers: 4}, true},
+		{VolumeEstimate{Bytes: 100, Containers: 4, Unknown: 2}, false},
+		// kubelets which don't report log usage can't skip the confirmation
+		{VolumeEstimate{Containers: 4, Unknown: 3}, true},
+		{VolumeEstimate{Containers: 4, Unknown: 4}, true},
+	}
+
+	for i, tt := range tests {
+		if actual := tt.estimate.Exceeds(1000); actual != tt.expected {
+			t.Errorf("%d: expected %v for %+v, got %v", i, tt.expected, tt.estimate, actual)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{3 << 30, "3.0GiB"},
+	}
+
+	for _, tt := range tests {
+		if actual := FormatBytes(tt.bytes); actual != tt.expected {
+			t.Errorf("FormatBytes(%d): expected %q, got %q", tt.bytes, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fetchLogs reads the logs of a target without following them and calls fn
+// for every line, which always ends with a newline
+func fetchLogs(ctx context.Context, source Source, target *Target, options *StreamOptions, fn func(line string)) error {
+	options.Follow = false
+
+	stream, err := source.Stream(ctx, target, options)
+	if err != nil {
+		return errors.Wrapf(err, "error opening stream to %s/%s: %s", target.Namespace, target.Pod, target.Container)
+	}
+	defer stream.Close()
+
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error reading logs of %s/%s: %s", target.Namespace, target.Pod, target.Container)
+		}
+	}
+}
+
+// forEachTarget calls fn for every target, running at most concurrency calls
+// at the same time, and waits for all of them to return
+func forEachTarget(ctx context.Context, targets []*Target, concurrency int, fn func(i int, t *Target)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *Target) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			fn(i, t)
+		}(i, t)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,98 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// GrepResult is the number of log lines of a container matching the pattern
+type GrepResult struct {
+	Namespace string
+	Pod       string
+	Container string
+	Matches   int
+	Err       error
+}
+
+// Grep fetches the logs of all matched containers without following them and
+// writes the lines matching pattern to out. At most config.MaxLogRequests
+// logs are fetched at the same time.
+func Grep(ctx context.Context, config *Config, pattern *regexp.Regexp, out io.Writer) ([]*GrepResult, error) {
+	clientset, namespace, err := newClientSet(config)
+	if err != nil {
+		return nil, err
+	}
+	config, namespace, err = resolve(clientset, namespace, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := confirmVolume(clientset, namespace, config); err != nil {
+		return nil, err
+	}
+
+	if config.Trace {
+		trace := newTraceWriter(out)
+		defer trace.Close()
+		out = trace
+	}
+
+	source := NewKubernetesSource(clientset, namespace)
+	targets, err := source.List(ctx, config.targetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*GrepResult, len(targets))
+	for i, t := range targets {
+		results[i] = &GrepResult{Namespace: t.Namespace, Pod: t.Pod, Container: t.Container, Err: context.Canceled}
+	}
+
+	redact := newRedactors(clientset, config)
+	var outMutex sync.Mutex
+	forEachTarget(ctx, targets, config.MaxLogRequests, func(i int, t *Target) {
+		result := results[i]
+		redactor, err := redact.forTarget(t)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		tail := newTail(t, config)
+		tail.Options.Redact = redactor
+		tail.podColor, tail.containerColor = determineColor(tail.PodName)
+
+		result.Err = fetchLogs(ctx, source, t, &StreamOptions{
+			Timestamps:   tail.Options.Timestamps || tail.Options.Envelope,
+			SinceSeconds: &tail.Options.SinceSeconds,
+			TailLines:    tail.Options.TailLines,
+			LimitBytes:   tail.Options.LimitBytes,
+		}, func(line string) {
+			ts, line := tail.splitTimestamp(line)
+			if !tail.Options.matches(line) || !pattern.MatchString(line) {
+				return
+			}
+			result.Matches++
+
+			outMutex.Lock()
+			defer outMutex.Unlock()
+			io.WriteString(out, tail.printAt(ts, line))
+		})
+	})
+
+	return results, nil
+}
@@ -0,0 +1,110 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// headersBatch is how long lines are held to group the bursts of the same
+// target under one header
+var headersBatch = 50 * time.Millisecond
+
+// headerMark delimits the header a tail puts in front of its lines in headers
+// mode, for the printer to take it off
+const headerMark = "\x00"
+
+// header returns the header announcing the lines of the tail in headers mode
+func (t *Tail) header() string {
+	p := t.podColor.SprintFunc()
+	c := t.containerColor.SprintFunc()
+	return fmt.Sprintf("==> %s/%s <==", p(t.Namespace+"/"+t.PodName), c(t.ContainerName))
+}
+
+// withHeader marks line as printed by the tail in headers mode
+func (t *Tail) withHeader(line string) string {
+	return headerMark + t.header() + headerMark + line
+}
+
+// splitHeader splits the header marked by withHeader from a line, returning
+// an empty header for lines without any, like the +/- markers
+func splitHeader(str string) (header, line string) {
+	if !strings.HasPrefix(str, headerMark) {
+		return "", str
+	}
+	parts := strings.SplitN(str[len(headerMark):], headerMark, 2)
+	if len(parts) != 2 {
+		return "", str
+	}
+	return parts[0], parts[1]
+}
+
+// headerGroup is the lines of a target held by a headerPrinter
+type headerGroup struct {
+	header string
+	lines  []string
+}
+
+// headerPrinter prints lines under a header naming their target, like
+// tail -f with several files, instead of prefixing every line. The header is
+// only printed when the target changes. Lines are held until flush to group
+// them by target.
+type headerPrinter struct {
+	out     io.Writer
+	last    string
+	printed bool
+	groups  []*headerGroup
+}
+
+func newHeaderPrinter(out io.Writer) *headerPrinter {
+	return &headerPrinter{out: out}
+}
+
+// add holds a line until the next flush
+func (p *headerPrinter) add(str string) {
+	header, line := splitHeader(str)
+	if header != "" {
+		for _, g := range p.groups {
+			if g.header == header {
+				g.lines = append(g.lines, line)
+				return
+			}
+		}
+	}
+	p.groups = append(p.groups, &headerGroup{header: header, lines: []string{line}})
+}
+
+// flush prints the lines held, grouped by target in the order their first
+// line came in
+func (p *headerPrinter) flush() {
+	for _, g := range p.groups {
+		if g.header != "" && g.header != p.last {
+			if p.printed {
+				io.WriteString(p.out, "\n")
+			}
+			io.WriteString(p.out, g.header+"\n")
+		}
+		for _, line := range g.lines {
+			io.WriteString(p.out, line)
+		}
+		// the header is repeated after lines without any
+		p.last = g.header
+		p.printed = true
+	}
+	p.groups = p.groups[:0]
+}
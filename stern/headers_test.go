@@ -0,0 +1,97 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+func TestHeaderPrinter(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	tmpl := template.Must(template.New("").Parse("{{.Message}}"))
+	newHeaderTail := func(pod, container string) *Tail {
+		tail := NewTail("ns", pod, container, tmpl, &TailOptions{Headers: true})
+		tail.podColor, tail.containerColor = determineColor(pod)
+		return tail
+	}
+	web, db := newHeaderTail("web-1", "nginx"), newHeaderTail("db-0", "postgres")
+
+	var out bytes.Buffer
+	p := newHeaderPrinter(&out)
+	p.add(web.Print("a\n"))
+	p.add(db.Print("b\n"))
+	p.add(web.Print("c\n"))
+	p.flush()
+	p.add(web.Print("d\n"))
+	p.flush()
+	p.add("+ db-0 › postgres\n")
+	p.add(db.Print("e\n"))
+	p.flush()
+
+	expected := `==> ns/web-1/nginx <==
+a
+c
+
+==> ns/db-0/postgres <==
+b
+
+==> ns/web-1/nginx <==
+d
++ db-0 › postgres
+
+==> ns/db-0/postgres <==
+e
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestRunSourceHeaders(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	config := newSourceConfig()
+	config.Headers = true
+	config.Template = template.Must(template.New("").Parse("{{.Message}}"))
+
+	until := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(until) })
+	var out syncBuffer
+	if err := run(context.Background(), newMemorySource(), nil, config, &out, until); err != nil {
+		t.Fatal(err)
+	}
+
+	output := out.buf.String()
+	if strings.Contains(output, headerMark) {
+		t.Errorf("unexpected header mark in %q", output)
+	}
+	for _, expected := range []string{"/nginx <==\nGET / 200\nGET /api 500\n", "/istio-proxy <==\nproxy ready\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+}
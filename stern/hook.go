@@ -0,0 +1,218 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Hook runs a local command when a log line matches its pattern
+type Hook struct {
+	Pattern *regexp.Regexp
+
+	// Command is run with sh -c, the line on its stdin and the target and
+	// the matched groups in STERN_* environment variables
+	Command string
+}
+
+// ParseHook parses a hook from regex=command. An = in the regex is escaped
+// as \=.
+func ParseHook(s string) (Hook, error) {
+	idx := -1
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == '=' {
+			idx = i
+			break
+		}
+	}
+	if idx <= 0 || idx == len(s)-1 {
+		return Hook{}, errors.Errorf("hook %q should be of the form regex=command", s)
+	}
+	pattern, err := regexp.Compile(s[:idx])
+	if err != nil {
+		return Hook{}, errors.Wrap(err, "failed to compile regular expression of hook")
+	}
+	return Hook{Pattern: pattern, Command: s[idx+1:]}, nil
+}
+
+// HookLimits limits how often and how long hooks run
+type HookLimits struct {
+	// Concurrency is the maximum number of hooks running at the same time,
+	// matches beyond it are skipped
+	Concurrency int
+
+	// Debounce is the time during which further matches of a hook on the
+	// same target are skipped after running it
+	Debounce time.Duration
+
+	// Timeout kills hooks running longer
+	Timeout time.Duration
+}
+
+// hookRunner runs the hooks of the lines of all tails
+type hookRunner struct {
+	ctx    context.Context
+	hooks  []Hook
+	limits HookLimits
+	slots  chan struct{}
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time
+	// closed is set once wait was called, the tails may still match lines
+	closed bool
+
+	// wg tracks the running hooks
+	wg sync.WaitGroup
+}
+
+// newHookRunner returns a runner for the hooks of config, or nil when there
+// are none
+func newHookRunner(ctx context.Context, config *Config) *hookRunner {
+	if len(config.Hooks) == 0 {
+		return nil
+	}
+	concurrency := config.HookLimits.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &hookRunner{
+		ctx:     ctx,
+		hooks:   config.Hooks,
+		limits:  config.HookLimits,
+		slots:   make(chan struct{}, concurrency),
+		lastRun: make(map[string]time.Time),
+	}
+}
+
+// run runs the hooks matching a line of a tail in the background
+func (h *hookRunner) run(t *Tail, line string) {
+	if h == nil {
+		return
+	}
+	for i, hook := range h.hooks {
+		groups := hook.Pattern.FindStringSubmatch(line)
+		if groups == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%s/%s/%s", i, t.Namespace, t.PodName, t.ContainerName)
+		started, full := h.start(key)
+		if full {
+			printTailStatus(t, fmt.Sprintf("skipped hook %q: %d hooks already running", hook.Command, cap(h.slots)))
+		}
+		if !started {
+			continue
+		}
+
+		go func(hook Hook, groups []string) {
+			defer func() {
+				<-h.slots
+				h.wg.Done()
+			}()
+			if err := h.exec(t, hook, line, groups); err != nil {
+				printTailStatus(t, fmt.Sprintf("hook %q failed: %s", hook.Command, err))
+			}
+		}(hook, groups)
+	}
+}
+
+// start acquires a slot for the hook of key, adds it to wg and records when it
+// ran. It doesn't start hooks once the runner is closed or which ran too
+// recently, nor when all slots are taken, returning full, so that a skipped
+// hook runs on the next match.
+func (h *hookRunner) start(key string) (started bool, full bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false, false
+	}
+	now := time.Now()
+	if last, ok := h.lastRun[key]; ok && now.Sub(last) < h.limits.Debounce {
+		return false, false
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		return false, true
+	}
+	h.lastRun[key] = now
+	h.wg.Add(1)
+	return true, false
+}
+
+// exec runs the command of a hook for a matched line
+func (h *hookRunner) exec(t *Tail, hook Hook, line string, groups []string) error {
+	ctx := h.ctx
+	if h.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.limits.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Stdin = strings.NewReader(line)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), hookEnv(t, hook.Pattern, groups)...)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("timed out after %s", h.limits.Timeout)
+	}
+	return err
+}
+
+// hookEnv returns the environment variables describing a target and the
+// groups matched in its line
+func hookEnv(t *Tail, pattern *regexp.Regexp, groups []string) []string {
+	env := []string{
+		"STERN_NAMESPACE=" + t.Namespace,
+		"STERN_POD=" + t.PodName,
+		"STERN_CONTAINER=" + t.ContainerName,
+		"STERN_NODE=" + t.NodeName,
+		"STERN_MATCH=" + groups[0],
+	}
+	names := pattern.SubexpNames()
+	for i := 1; i < len(groups); i++ {
+		env = append(env, fmt.Sprintf("STERN_MATCH_%d=%s", i, groups[i]))
+		if names[i] != "" {
+			env = append(env, fmt.Sprintf("STERN_MATCH_%s=%s", strings.ToUpper(names[i]), groups[i]))
+		}
+	}
+	return env
+}
+
+// wait stops starting hooks and waits for the running ones to end
+func (h *hookRunner) wait() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.wg.Wait()
+}
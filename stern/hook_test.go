@@ -0,0 +1,135 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHook(t *testing.T) {
+	hook, err := ParseHook(`status\=(?P<code>5\d\d)=./dump.sh --code=$STERN_MATCH_CODE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.Pattern.String() != `status\=(?P<code>5\d\d)` || hook.Command != "./dump.sh --code=$STERN_MATCH_CODE" {
+		t.Errorf("unexpected hook %s=%s", hook.Pattern, hook.Command)
+	}
+
+	for _, s := range []string{"no-command", "=cmd", "regex=", "(=cmd"} {
+		if _, err := ParseHook(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestHookRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	hook, err := ParseHook(`status\=(?P<code>5\d\d)=cat > ` + out + `; echo "$STERN_POD $STERN_NODE $STERN_MATCH_1 $STERN_MATCH_CODE" >> ` + out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHookRunner(context.Background(), &Config{
+		Hooks:      []Hook{hook},
+		HookLimits: HookLimits{Concurrency: 1, Debounce: time.Hour},
+	})
+
+	tail := NewTail("ns", "web-1", "app", nil, &TailOptions{})
+	tail.NodeName = "node1"
+	tail.podColor, tail.containerColor = determineColor(tail.PodName)
+
+	h.run(tail, "GET / status=200\n")
+	h.run(tail, "GET / status=503\n")
+	h.wait()
+	h.run(tail, "GET / status=500\n")
+	h.wait()
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "GET / status=503\nweb-1 node1 503 503\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, string(b))
+	}
+}
+
+func TestHookRunnerLimits(t *testing.T) {
+	hook, err := ParseHook("error=exec sleep 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHookRunner(context.Background(), &Config{
+		Hooks:      []Hook{hook},
+		HookLimits: HookLimits{Concurrency: 1, Debounce: time.Minute, Timeout: 50 * time.Millisecond},
+	})
+
+	tail := NewTail("ns", "web-1", "app", nil, &TailOptions{})
+	tail.podColor, tail.containerColor = determineColor(tail.PodName)
+	other := NewTail("ns", "web-2", "app", nil, &TailOptions{})
+	other.podColor, other.containerColor = determineColor(other.PodName)
+
+	start := time.Now()
+	h.run(tail, "error\n")
+	// skipped, the only slot is taken
+	h.run(other, "error\n")
+	for len(h.slots) > 0 && time.Since(start) < 5*time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if d := time.Since(start); d >= 5*time.Second {
+		t.Errorf("expected the hook to time out, took %s", d)
+	}
+	if _, ok := h.lastRun["0/ns/web-2/app"]; ok || len(h.lastRun) != 1 || len(h.slots) != 0 {
+		t.Errorf("expected the skipped hook not to be debounced, got %v", h.lastRun)
+	}
+
+	// the skipped hook runs on its next match, the first one is debounced
+	h.run(other, "error\n")
+	h.run(tail, "error\n")
+	h.wait()
+	if len(h.lastRun) != 2 || len(h.slots) != 0 {
+		t.Errorf("unexpected runner state %v", h.lastRun)
+	}
+
+	// tails still reading after run returned don't start hooks
+	third := NewTail("ns", "web-3", "app", nil, &TailOptions{})
+	h.run(third, "error\n")
+	if len(h.lastRun) != 2 || len(h.slots) != 0 {
+		t.Errorf("expected no hook to start once waited for, got %v", h.lastRun)
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+	hook, _ := ParseHook(`user\=(\w+) code\=(?P<code>\d+)=true`)
+	tail := NewTail("ns", "web-1", "app", nil, &TailOptions{})
+	groups := hook.Pattern.FindStringSubmatch("user=bob code=42")
+
+	env := strings.Join(hookEnv(tail, hook.Pattern, groups), " ")
+	expected := "STERN_NAMESPACE=ns STERN_POD=web-1 STERN_CONTAINER=app STERN_NODE= STERN_MATCH=user=bob code=42 STERN_MATCH_1=bob STERN_MATCH_2=42 STERN_MATCH_CODE=42"
+	if env != expected {
+		t.Errorf("expected %q, got %q", expected, env)
+	}
+}
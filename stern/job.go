@@ -0,0 +1,205 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8s "k8s.io/client-go/kubernetes"
+	batchclient "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+// JobResult is the outcome of a Job
+type JobResult struct {
+	Namespace string
+	Name      string
+
+	// Succeeded is true when the Job completed, and false when it failed
+	Succeeded bool
+
+	// Reason and Message explain why the Job failed
+	Reason  string
+	Message string
+
+	// Pods are the attempts at running the Job, oldest first
+	Pods []JobPod
+}
+
+// JobPod is an attempt at running a Job
+type JobPod struct {
+	Name  string
+	Phase corev1.PodPhase
+
+	// ExitCode and Reason are those of the first container which failed, or
+	// of the first one which terminated when none failed
+	ExitCode int32
+	Reason   string
+}
+
+// jobPollInterval is how often the status of a Job is checked
+var jobPollInterval = 2 * time.Second
+
+// resolveJob narrows a config down to the pods of a Job, including those of
+// its retries. Terminated containers are tailed too, so that their logs are
+// shown to the end.
+func resolveJob(clientset k8s.Interface, namespace string, config *Config) (*Config, string, error) {
+	if namespace == "" {
+		return nil, "", errors.New("job queries need a namespace, they can't be used with --all-namespaces")
+	}
+	job, err := clientset.BatchV1().Jobs(namespace).Get(config.ResourceQuery.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to get job")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to parse selector of job")
+	}
+	if config.LabelSelector != nil {
+		requirements, _ := config.LabelSelector.Requirements()
+		selector = selector.Add(requirements...)
+	}
+
+	resolved := *config
+	resolved.LabelSelector = selector
+	if !config.ContainerState.has(TERMINATED) {
+		resolved.ContainerState = append(ContainerState{TERMINATED}, config.ContainerState...)
+	}
+	return &resolved, namespace, nil
+}
+
+// WaitJob tails the pods of the Job of a job/NAME query until the Job
+// completes or fails, and returns its outcome
+func WaitJob(ctx context.Context, config *Config) (*JobResult, error) {
+	if config.ResourceQuery == nil || config.ResourceQuery.Kind != KindJob {
+		return nil, errors.New("waiting requires a job/NAME query")
+	}
+
+	clientset, namespace, err := newClientSet(config)
+	if err != nil {
+		return nil, err
+	}
+	config, namespace, err = resolve(clientset, namespace, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := confirmVolume(clientset, namespace, config); err != nil {
+		return nil, err
+	}
+
+	finished := make(chan struct{})
+	var job *batchv1.Job
+	var jobErr error
+	go func() {
+		defer close(finished)
+		job, jobErr = waitJobFinished(ctx, clientset.BatchV1().Jobs(namespace), config.ResourceQuery.Name)
+	}()
+
+	source := NewKubernetesSource(clientset, namespace)
+	if err := run(ctx, source, newRedactors(clientset, config), config, os.Stdout, finished); err != nil {
+		return nil, err
+	}
+	<-finished
+	if jobErr != nil {
+		return nil, jobErr
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: config.LabelSelector.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods of job")
+	}
+	return jobResult(job, pods.Items), nil
+}
+
+// waitJobFinished returns the Job once it completed or failed
+func waitJobFinished(ctx context.Context, i batchclient.JobInterface, name string) (*batchv1.Job, error) {
+	var job *batchv1.Job
+	err := wait.PollImmediateUntil(jobPollInterval, func() (bool, error) {
+		var err error
+		job, err = i.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrap(err, "failed to get job")
+		}
+		return jobFinished(job), nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return nil, ctx.Err()
+	}
+	return job, err
+}
+
+// jobFinished returns true when a Job completed or failed
+func jobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// jobResult returns the outcome of a finished Job run by pods
+func jobResult(job *batchv1.Job, pods []corev1.Pod) *JobResult {
+	result := &JobResult{Namespace: job.Namespace, Name: job.Name}
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			result.Succeeded = true
+		case batchv1.JobFailed:
+			result.Reason = c.Reason
+			result.Message = c.Message
+		}
+	}
+
+	sortPods(pods)
+	for _, pod := range pods {
+		p := JobPod{Name: pod.Name, Phase: pod.Status.Phase}
+		var terminated *corev1.ContainerStateTerminated
+		for _, s := range pod.Status.ContainerStatuses {
+			t := s.State.Terminated
+			if t == nil {
+				continue
+			}
+			if terminated == nil || (terminated.ExitCode == 0 && t.ExitCode != 0) {
+				terminated = t
+			}
+		}
+		if terminated != nil {
+			p.ExitCode = terminated.ExitCode
+			p.Reason = terminated.Reason
+		} else if pod.Status.Reason != "" {
+			p.Reason = pod.Status.Reason
+		}
+		result.Pods = append(result.Pods, p)
+	}
+	return result
+}
+
+// sortPods sorts pods by creation, oldest first
+func sortPods(pods []corev1.Pod) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+}
@@ -0,0 +1,132 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newJob(conditions ...batchv1.JobCondition) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "migrate"},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1234"}},
+		},
+		Status: batchv1.JobStatus{Conditions: conditions},
+	}
+}
+
+func TestResolveJob(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newJob())
+	selector, _ := labels.Parse("tier=db")
+	config := &Config{
+		ResourceQuery:  ParseResourceQuery("job/migrate"),
+		ContainerState: ContainerState{RUNNING, WAITING},
+		LabelSelector:  selector,
+	}
+
+	resolved, namespace, err := resolve(clientset, "shop", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "shop" {
+		t.Errorf("expected namespace shop, got %s", namespace)
+	}
+	if s := resolved.LabelSelector.String(); s != "controller-uid=1234,tier=db" {
+		t.Errorf("unexpected selector %s", s)
+	}
+	if !resolved.ContainerState.has(TERMINATED) || config.ContainerState.has(TERMINATED) {
+		t.Errorf("expected terminated containers to be tailed without changing the config")
+	}
+
+	if _, _, err := resolve(clientset, "", config); err == nil {
+		t.Errorf("expected an error for all namespaces")
+	}
+	if _, _, err := resolve(clientset, "staging", config); err == nil {
+		t.Errorf("expected an error for a missing job")
+	}
+}
+
+func TestWaitJobFinished(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = 10 * time.Millisecond
+
+	clientset := fake.NewSimpleClientset(newJob(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}))
+	job, err := waitJobFinished(context.Background(), clientset.BatchV1().Jobs("shop"), "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jobFinished(job) {
+		t.Errorf("expected the job to be finished")
+	}
+
+	clientset = fake.NewSimpleClientset(newJob())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := waitJobFinished(ctx, clientset.BatchV1().Jobs("shop"), "migrate"); err != context.DeadlineExceeded {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestJobResult(t *testing.T) {
+	job := newJob(batchv1.JobCondition{
+		Type:    batchv1.JobFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "BackoffLimitExceeded",
+		Message: "Job has reached the specified backoff limit",
+	})
+	terminated := func(name string, exitCode int32, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason},
+		}}
+	}
+	pod := func(name string, created int64, phase corev1.PodPhase, statuses ...corev1.ContainerStatus) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Unix(created, 0)},
+			Status:     corev1.PodStatus{Phase: phase, ContainerStatuses: statuses},
+		}
+	}
+
+	result := jobResult(job, []corev1.Pod{
+		pod("migrate-b", 2, corev1.PodFailed, terminated("sidecar", 0, "Completed"), terminated("migrate", 137, "OOMKilled")),
+		pod("migrate-a", 1, corev1.PodFailed, terminated("migrate", 1, "Error")),
+		pod("migrate-c", 3, corev1.PodFailed),
+	})
+
+	if result.Succeeded || result.Reason != "BackoffLimitExceeded" {
+		t.Errorf("expected the job to have failed, got %+v", result)
+	}
+	expected := []JobPod{
+		{Name: "migrate-a", Phase: corev1.PodFailed, ExitCode: 1, Reason: "Error"},
+		{Name: "migrate-b", Phase: corev1.PodFailed, ExitCode: 137, Reason: "OOMKilled"},
+		{Name: "migrate-c", Phase: corev1.PodFailed},
+	}
+	if len(result.Pods) != len(expected) {
+		t.Fatalf("expected %d pods, got %d", len(expected), len(result.Pods))
+	}
+	for i, p := range expected {
+		if result.Pods[i] != p {
+			t.Errorf("pod %d: expected %+v, got %+v", i, p, result.Pods[i])
+		}
+	}
+}
@@ -0,0 +1,243 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JournalNamespace is the namespace of the targets of journal entries, whose
+// pod is the hostname and container the systemd unit
+const JournalNamespace = "journal"
+
+// journalctl is the command following the journal
+const journalctl = "journalctl"
+
+// followJournal merges the entries of the journal of the selected units into
+// logC, following journalctl or reading journal export files until ctx is
+// done
+func followJournal(ctx context.Context, config *Config, logC chan<- string) error {
+	j := &journal{config: config, logC: logC, tails: make(map[string]*Tail)}
+
+	if len(config.JournalFiles) > 0 {
+		go func() {
+			for _, path := range config.JournalFiles {
+				if err := j.readExportFile(ctx, path); err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+				}
+			}
+		}()
+		return nil
+	}
+
+	args := []string{"--output=json", "--follow", "--all"}
+	if config.TailLines != nil {
+		args = append(args, fmt.Sprintf("--lines=%d", *config.TailLines))
+	} else {
+		args = append(args, "--lines=all", fmt.Sprintf("--since=-%ds", int64(config.Since.Seconds())))
+	}
+	for _, unit := range config.JournalUnits {
+		args = append(args, "--unit="+unit)
+	}
+
+	cmd := exec.CommandContext(ctx, journalctl, args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "failed to follow the journal")
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to follow the journal")
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			entry, err := parseJournalJSON(scanner.Bytes())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to parse journal entry: %s\n", err)
+				continue
+			}
+			if !j.send(ctx, entry) {
+				break
+			}
+		}
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "journalctl stopped: %s\n", err)
+		}
+	}()
+	return nil
+}
+
+// journal prints journal entries like the logs of containers
+type journal struct {
+	config *Config
+	logC   chan<- string
+	tails  map[string]*Tail
+}
+
+// send prints an entry to the log channel, returning false once ctx is done
+func (j *journal) send(ctx context.Context, entry map[string]string) bool {
+	msg, ok := entry["MESSAGE"]
+	if !ok {
+		return true
+	}
+
+	unit := entry["_SYSTEMD_UNIT"]
+	if unit == "" {
+		unit = entry["SYSLOG_IDENTIFIER"]
+	}
+	target := &Target{Namespace: JournalNamespace, Pod: entry["_HOSTNAME"], Container: unit, Node: entry["_HOSTNAME"]}
+	tail := j.tails[target.GetID()]
+	if tail == nil {
+		tail = newTail(target, j.config)
+		tail.podColor, tail.containerColor = determineColor(target.Pod)
+		j.tails[target.GetID()] = tail
+	}
+
+	msg = strings.TrimRight(msg, "\r\n") + "\n"
+	if !tail.Options.matches(msg) {
+		return true
+	}
+
+	var ts time.Time
+	if usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		ts = time.Unix(0, usec*int64(time.Microsecond)).UTC()
+	}
+
+	select {
+	case j.logC <- tail.printTimed(ts, msg):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseJournalJSON parses an entry printed by journalctl --output=json. Fields
+// which aren't valid UTF-8 are arrays of bytes.
+func parseJournalJSON(line []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, err
+	}
+
+	entry := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			entry[key] = s
+			continue
+		}
+		var b []byte
+		var ints []int
+		if err := json.Unmarshal(value, &ints); err == nil {
+			for _, i := range ints {
+				b = append(b, byte(i))
+			}
+			entry[key] = string(b)
+		}
+	}
+	return entry, nil
+}
+
+// readExportFile prints the entries of the selected units in a file of the
+// journal export format, as written by journalctl --output=export
+func (j *journal) readExportFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal export file")
+	}
+	defer f.Close()
+
+	return readJournalExport(f, func(entry map[string]string) bool {
+		if !j.selects(entry) {
+			return true
+		}
+		return j.send(ctx, entry)
+	})
+}
+
+// selects returns true when the entry belongs to one of the selected units,
+// or when no unit was selected
+func (j *journal) selects(entry map[string]string) bool {
+	if len(j.config.JournalUnits) == 0 {
+		return true
+	}
+	unit := entry["_SYSTEMD_UNIT"]
+	for _, u := range j.config.JournalUnits {
+		if unit == u || unit == u+".service" {
+			return true
+		}
+	}
+	return false
+}
+
+// readJournalExport calls fn with every entry of the journal export format
+// until it returns false. Fields are KEY=value lines, or the key followed by
+// the size of the value as a little endian uint64 for binary values, and
+// entries are separated by an empty line.
+func readJournalExport(r io.Reader, fn func(map[string]string) bool) error {
+	reader := bufio.NewReader(r)
+	entry := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if len(entry) > 0 {
+				fn(entry)
+			}
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "failed to read journal export")
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" {
+			if len(entry) > 0 && !fn(entry) {
+				return nil
+			}
+			entry = make(map[string]string)
+			continue
+		}
+
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			entry[line[:i]] = line[i+1:]
+			continue
+		}
+
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return errors.Wrapf(err, "failed to read size of journal field %s", line)
+		}
+		value := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return errors.Wrapf(err, "failed to read journal field %s", line)
+		}
+		entry[line] = string(value[:size])
+	}
+}
@@ -0,0 +1,135 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func newJournalConfig() *Config {
+	return &Config{
+		Template: template.Must(template.New("").Parse("{{.Namespace}} {{.PodName}} {{.ContainerName}} {{.Message}}")),
+		Since:    time.Hour,
+	}
+}
+
+// collect returns the lines sent to logC until none came for a while
+func collect(logC <-chan string) []string {
+	var lines []string
+	for {
+		select {
+		case line := <-logC:
+			lines = append(lines, line)
+		case <-time.After(500 * time.Millisecond):
+			return lines
+		}
+	}
+}
+
+func TestFollowJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+echo '{"__REALTIME_TIMESTAMP":"1561024800000000","_HOSTNAME":"node-1","_SYSTEMD_UNIT":"kubelet.service","MESSAGE":"Started kubelet"}'
+echo '{"__REALTIME_TIMESTAMP":"1561024801000000","_HOSTNAME":"node-1","SYSLOG_IDENTIFIER":"containerd","MESSAGE":[104,105]}'
+echo '{"__REALTIME_TIMESTAMP":"1561024802000000","_HOSTNAME":"node-1","_SYSTEMD_UNIT":"kubelet.service","MESSAGE":"healthz ok"}'
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "journalctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := newJournalConfig()
+	config.JournalUnits = []string{"kubelet", "containerd"}
+	config.Exclude = []*regexp.Regexp{regexp.MustCompile("healthz")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logC := make(chan string)
+	if err := followJournal(ctx, config, logC); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"journal node-1 kubelet.service Started kubelet\n",
+		"journal node-1 containerd hi\n",
+	}
+	lines := collect(logC)
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(args)); s != "--output=json --follow --all --lines=all --since=-3600s --unit=kubelet --unit=containerd" {
+		t.Errorf("unexpected arguments %s", s)
+	}
+}
+
+func TestReadJournalExport(t *testing.T) {
+	var export bytes.Buffer
+	export.WriteString("__REALTIME_TIMESTAMP=1561024800000000\n_HOSTNAME=node-1\n_SYSTEMD_UNIT=kubelet.service\nMESSAGE=Started kubelet\n\n")
+	export.WriteString("__REALTIME_TIMESTAMP=1561024801000000\n_HOSTNAME=node-1\n_SYSTEMD_UNIT=sshd.service\nMESSAGE=Accepted key\n\n")
+	export.WriteString("__REALTIME_TIMESTAMP=1561024802000000\n_HOSTNAME=node-1\n_SYSTEMD_UNIT=kubelet.service\nMESSAGE\n")
+	binary.Write(&export, binary.LittleEndian, uint64(10))
+	export.WriteString("line\nbreak\n")
+
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kubelet.export")
+	if err := ioutil.WriteFile(path, export.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := newJournalConfig()
+	config.Timestamps = true
+	config.JournalUnits = []string{"kubelet"}
+	config.JournalFiles = []string{path}
+
+	logC := make(chan string)
+	if err := followJournal(context.Background(), config, logC); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"journal node-1 kubelet.service 2019-06-20T10:00:00Z Started kubelet\n",
+		"journal node-1 kubelet.service 2019-06-20T10:00:02Z line\nbreak\n",
+	}
+	lines := collect(logC)
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
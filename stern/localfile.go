@@ -0,0 +1,317 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LocalNamespace is the namespace of the targets of local files, whose pod is
+// the path of the file
+const LocalNamespace = "local"
+
+// localFileContainer is the container of the targets of local files
+const localFileContainer = "file"
+
+// localFilePollInterval is the time between two checks of the local files
+var localFilePollInterval = 250 * time.Millisecond
+
+// localFileCheckBytes is the number of bytes before the offset compared to
+// tell a file truncated and refilled past the offset from one appended to
+const localFileCheckBytes = 64
+
+// followLocalFiles merges the lines of the local files matching the globs of
+// config into logC until ctx is done, like tail -F. Files created later are
+// followed from their start.
+func followLocalFiles(ctx context.Context, config *Config, logC chan<- string) error {
+	for _, pattern := range config.LocalFiles {
+		if _, err := filepath.Glob(pattern); err != nil {
+			return errors.Wrapf(err, "invalid local file %s", pattern)
+		}
+	}
+
+	followers := make(map[string]*fileFollower)
+	discover := func(initial bool) {
+		for _, pattern := range config.LocalFiles {
+			paths, _ := filepath.Glob(pattern)
+			if initial && len(paths) == 0 {
+				fmt.Fprintf(os.Stderr, "no local files match %s yet\n", pattern)
+			}
+			for _, path := range paths {
+				if followers[path] != nil {
+					continue
+				}
+				if info, err := os.Stat(path); err != nil || info.IsDir() {
+					continue
+				}
+				f := newFileFollower(path, config, logC)
+				lines := config.TailLines
+				if !initial {
+					lines = nil
+				}
+				if err := f.open(ctx, initial, lines); err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+					continue
+				}
+				followers[path] = f
+			}
+		}
+	}
+
+	go func() {
+		discover(true)
+		ticker := time.NewTicker(localFilePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, f := range followers {
+					f.poll(ctx)
+				}
+				discover(false)
+			case <-ctx.Done():
+				for _, f := range followers {
+					f.close()
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// fileFollower follows a local file across rotation and truncation
+type fileFollower struct {
+	path    string
+	tail    *Tail
+	logC    chan<- string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+
+	// last holds the bytes before offset
+	last []byte
+}
+
+func newFileFollower(path string, config *Config, logC chan<- string) *fileFollower {
+	target := &Target{Namespace: LocalNamespace, Pod: path, Container: localFileContainer}
+	tail := newTail(target, config)
+	tail.podColor, tail.containerColor = determineColor(path)
+	return &fileFollower{path: path, tail: tail, logC: logC}
+}
+
+// open starts following the file, from its end when initial, or from its
+// last lines when lines is set
+func (f *fileFollower) open(ctx context.Context, initial bool, lines *int64) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open local file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to open local file")
+	}
+
+	offset := int64(0)
+	if lines != nil {
+		offset, err = lastLinesOffset(file, info.Size(), *lines)
+	} else if initial {
+		offset = info.Size()
+	}
+	var last []byte
+	if err == nil {
+		last, err = bytesBefore(file, offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "failed to read local file")
+	}
+
+	f.file, f.info, f.offset, f.partial, f.last = file, info, offset, nil, last
+	if f.tail.Options.Envelope {
+		f.send(ctx, f.tail.printEvent(EventAdded))
+	} else {
+		f.send(ctx, f.tail.addedMarker())
+	}
+	f.read(ctx)
+	return nil
+}
+
+// poll reads the lines appended since the last poll, and reopens the file
+// when it was rotated or truncated. The partial last line of the file is sent
+// before, as nothing will complete it.
+func (f *fileFollower) poll(ctx context.Context) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// rotated away, wait for the new file
+		if f.file != nil {
+			f.read(ctx)
+		}
+		return
+	}
+
+	if f.file != nil && os.SameFile(info, f.info) {
+		if f.truncated(info) {
+			printTailStatus(f.tail, "truncated")
+			f.flush(ctx)
+			if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "failed to read local file"))
+				return
+			}
+			f.offset, f.last = 0, nil
+		}
+		f.info = info
+		f.read(ctx)
+		return
+	}
+
+	if f.file != nil {
+		f.read(ctx)
+		f.flush(ctx)
+		printTailStatus(f.tail, "rotated")
+		f.close()
+	}
+	if err := f.open(ctx, false, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+}
+
+// truncated returns true when the file was truncated since the last poll,
+// including when it was refilled past the offset since, as copytruncate does
+func (f *fileFollower) truncated(info os.FileInfo) bool {
+	if info.Size() < f.offset {
+		return true
+	}
+	if info.Size() == f.info.Size() && info.ModTime().Equal(f.info.ModTime()) {
+		return false
+	}
+	// appending leaves the bytes already read alone
+	last, err := bytesBefore(f.file, f.offset)
+	return err != nil || !bytes.Equal(last, f.last)
+}
+
+// flush sends the partial last line
+func (f *fileFollower) flush(ctx context.Context) {
+	if len(f.partial) == 0 {
+		return
+	}
+	line := string(f.partial) + "\n"
+	f.partial = nil
+	if f.tail.Options.matches(line) {
+		f.send(ctx, f.tail.printTimed(time.Now(), line))
+	}
+}
+
+// read sends the complete lines appended to the file
+func (f *fileFollower) read(ctx context.Context) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.file.Read(buf)
+		f.offset += int64(n)
+		data := append(f.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			line := string(data[:i+1])
+			data = data[i+1:]
+			if f.tail.Options.matches(line) {
+				f.send(ctx, f.tail.printTimed(time.Now(), line))
+			}
+		}
+		f.partial = append([]byte(nil), data...)
+		f.last = append(f.last, buf[:n]...)
+		if len(f.last) > localFileCheckBytes {
+			f.last = append([]byte(nil), f.last[len(f.last)-localFileCheckBytes:]...)
+		}
+		if err != nil || n == 0 {
+			return
+		}
+	}
+}
+
+func (f *fileFollower) send(ctx context.Context, s string) {
+	select {
+	case f.logC <- s:
+	case <-ctx.Done():
+	}
+}
+
+func (f *fileFollower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// bytesBefore returns the localFileCheckBytes bytes before offset, or fewer at
+// the start of the file
+func bytesBefore(r io.ReaderAt, offset int64) ([]byte, error) {
+	start := offset - localFileCheckBytes
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, offset-start)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// lastLinesOffset returns the offset of the last n lines of a file of size
+func lastLinesOffset(r io.ReaderAt, size int64, n int64) (int64, error) {
+	if n == 0 {
+		return size, nil
+	}
+	const chunk = 32 * 1024
+	buf := make([]byte, chunk)
+	newlines := int64(0)
+	for end := size; end > 0; {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		data := buf[:end-start]
+		if _, err := r.ReadAt(data, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(data) - 1; i >= 0; i-- {
+			// a trailing newline ends the last line rather than starting one
+			if data[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,149 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFollowLocalFiles(t *testing.T) {
+	defer func(interval time.Duration) { localFilePollInterval = interval }(localFilePollInterval)
+	localFilePollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "client.log")
+	if err := ioutil.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	two := int64(2)
+	config := &Config{
+		Template:   template.Must(template.New("").Parse("{{.Namespace}} {{.ContainerName}} {{.Message}}")),
+		LocalFiles: []string{filepath.Join(dir, "*.log")},
+		TailLines:  &two,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logC := make(chan string)
+	if err := followLocalFiles(ctx, config, logC); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(step string, expected ...string) {
+		var lines []string
+		for _, line := range collect(logC) {
+			if !strings.HasPrefix(line, "+") {
+				lines = append(lines, line)
+			}
+		}
+		if strings.Join(lines, "") != strings.Join(expected, "") {
+			t.Errorf("%s: expected %q, got %q", step, expected, lines)
+		}
+	}
+	expect("start", "local file two\n", "local file three\n")
+
+	appendFile(t, path, "fo")
+	expect("partial line")
+	appendFile(t, path, "ur\n")
+	expect("append", "local file four\n")
+
+	if err := ioutil.WriteFile(path, []byte("five\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("truncate", "local file five\n")
+
+	appendFile(t, path, "six\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("seven\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("rotate", "local file six\n", "local file seven\n")
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.log"), []byte("eight\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("new file", "local file eight\n")
+
+	// copytruncate refilling the file past the offset between two polls
+	appendFile(t, path, "ni")
+	expect("partial line before truncation")
+	if err := ioutil.WriteFile(path, []byte("ten ten ten\neleven\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("truncate and refill", "local file ni\n", "local file ten ten ten\n", "local file eleven\n")
+
+	appendFile(t, path, "twe")
+	expect("partial line before rotation")
+	if err := os.Rename(path, path+".2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("thirteen\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("rotate after a partial line", "local file twe\n", "local file thirteen\n")
+
+	if err := followLocalFiles(ctx, &Config{LocalFiles: []string{"[a-"}}, logC); err == nil {
+		t.Errorf("expected an error for an invalid glob")
+	}
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	tests := []struct {
+		content  string
+		n        int64
+		expected int64
+	}{
+		{"one\ntwo\nthree\n", 1, 8},
+		{"one\ntwo\nthree\n", 2, 4},
+		{"one\ntwo\nthree\n", 5, 0},
+		{"one\ntwo\nthree", 1, 8},
+		{"one\ntwo\nthree\n", 0, 14},
+		{"", 3, 0},
+	}
+	for _, tt := range tests {
+		offset, err := lastLinesOffset(strings.NewReader(tt.content), int64(len(tt.content)), tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != tt.expected {
+			t.Errorf("%q, %d: expected %d, got %d", tt.content, tt.n, tt.expected, offset)
+		}
+	}
+}
@@ -17,110 +17,378 @@ package stern
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"sync"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"github.com/wercker/stern/kubernetes"
+	k8s "k8s.io/client-go/kubernetes"
 )
 
 // Run starts the main run loop
 func Run(ctx context.Context, config *Config) error {
-	clientConfig := kubernetes.NewClientConfig(config.KubeConfig, config.ContextName)
-	clientset, err := kubernetes.NewClientSet(clientConfig)
+	clientset, namespace, err := newClientSet(config)
 	if err != nil {
 		return err
 	}
+	config, namespace, err = resolve(clientset, namespace, config)
+	if err != nil {
+		return err
+	}
+	if err := confirmVolume(clientset, namespace, config); err != nil {
+		return err
+	}
+	return run(ctx, NewKubernetesSource(clientset, namespace), newRedactors(clientset, config), config, os.Stdout, nil)
+}
 
-	var namespace string
-	// A specific namespace is ignored if all-namespaces is provided
-	if config.AllNamespaces {
-		namespace = ""
-	} else {
-		namespace = config.Namespace
-		if namespace == "" {
-			namespace, _, err = clientConfig.Namespace()
-			if err != nil {
-				return errors.Wrap(err, "unable to get default namespace")
+// RunSource tails the targets of config from source until ctx is done,
+// writing the logs to out
+func RunSource(ctx context.Context, source Source, config *Config, out io.Writer) error {
+	return run(ctx, source, nil, config, out, nil)
+}
+
+// run tails the targets of config from source until ctx is done. Once until
+// is closed, it returns as soon as the targets listed then were tailed and the
+// tails ended, or after drainTimeout.
+func run(ctx context.Context, source Source, redact *redactors, config *Config, out io.Writer, until <-chan struct{}) error {
+	var err error
+	if config.Trace {
+		trace := newTraceWriter(out)
+		defer trace.Close()
+		out = trace
+	}
+	logC := make(chan string, 1024)
+	hooks := newHookRunner(ctx, config)
+	defer hooks.wait()
+
+	// the lines sent until run returns are written
+	stop := make(chan struct{})
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+
+		var headers *headerPrinter
+		var flush <-chan time.Time
+		if config.Headers {
+			headers = newHeaderPrinter(out)
+		}
+		print := func(str string) {
+			if headers == nil {
+				io.WriteString(out, str)
+				return
 			}
+			headers.add(str)
+			if flush == nil {
+				flush = time.After(headersBatch)
+			}
+		}
+
+		for {
+			select {
+			case str := <-logC:
+				print(str)
+			case <-flush:
+				flush = nil
+				headers.flush()
+			case <-stop:
+				for {
+					select {
+					case str := <-logC:
+						print(str)
+					default:
+						if headers != nil {
+							headers.flush()
+						}
+						return
+					}
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-printed
+	}()
+
+	if len(config.JournalUnits) > 0 || len(config.JournalFiles) > 0 {
+		if err := followJournal(ctx, config, logC); err != nil {
+			return err
+		}
+	}
+
+	if len(config.LocalFiles) > 0 {
+		if err := followLocalFiles(ctx, config, logC); err != nil {
+			return err
+		}
+	}
+
+	// targets whose recent lines were already printed resume after the last
+	// line fetched
+	var fetched map[string]time.Time
+	if config.TailTotal != nil {
+		fetched, err = tailTotal(ctx, source, config, redact, logC)
+		if err != nil {
+			return err
 		}
 	}
 
-	added, removed, err := Watch(ctx,
-		clientset.CoreV1().Pods(namespace),
-		config.PodQuery,
-		config.ContainerQuery,
-		config.ExcludeContainerQuery,
-		config.InitContainers,
-		config.ContainerState,
-		config.LabelSelector)
+	added, removed, err := source.Watch(ctx, config.targetFilter())
 	if err != nil {
 		return errors.Wrap(err, "failed to set up watch")
 	}
 
 	tails := make(map[string]*Tail)
-	tailsMutex := sync.RWMutex{}
-	logC := make(chan string, 1024)
+	retries := make(map[string]*retryState)
+	retryC := make(chan *Target)
+	failedC := make(chan *Tail)
+	openedC := make(chan *Tail)
 
-	go func() {
-		for {
+	startTail := func(p *Target, retry bool) {
+		tail := newTail(p, config)
+		tail.redactors = redact
+		tail.hooks = hooks
+		tail.retry = retry
+		if last, ok := fetched[p.GetID()]; ok {
+			tail.Options.TailLines = nil
+			tail.Options.Resume = last
+		}
+		tails[p.GetID()] = tail
+		tail.StartSource(ctx, source, logC)
+
+		go func() {
 			select {
-			case str := <-logC:
-				fmt.Fprintf(os.Stdout, str)
-			case <-ctx.Done():
-				break
+			case <-tail.Failed():
+				select {
+				case failedC <- tail:
+				case <-ctx.Done():
+				}
+			case <-tail.Opened():
+				select {
+				case openedC <- tail:
+				case <-ctx.Done():
+				}
+			case <-tail.closed:
 			}
+		}()
+	}
+
+	// drain is set once until is closed
+	var drain <-chan time.Time
+	var drainDeadline time.Time
+	// unseen are the targets listed once until is closed which the watch
+	// didn't add yet, such as the pods of a Job which finished before run
+	var unseen map[string]bool
+	drained := func() bool {
+		if len(unseen) > 0 {
+			return false
 		}
-	}()
+		for id, t := range tails {
+			if r := retries[id]; r != nil && r.pending {
+				return false
+			}
+			select {
+			case <-t.Done():
+			default:
+				return false
+			}
+		}
+		return true
+	}
 
-	go func() {
-		for p := range added {
+	for {
+		select {
+		case <-until:
+			until = nil
+			targets, err := source.List(ctx, config.targetFilter())
+			if err != nil {
+				return err
+			}
+			unseen = make(map[string]bool)
+			for _, p := range targets {
+				if tails[p.GetID()] == nil {
+					unseen[p.GetID()] = true
+				}
+			}
+			drainDeadline = time.Now().Add(drainTimeout)
+			ticker := time.NewTicker(100 * time.Millisecond)
+			defer ticker.Stop()
+			drain = ticker.C
+
+		case <-drain:
+			if drained() || time.Now().After(drainDeadline) {
+				return nil
+			}
+
+		case p, ok := <-added:
+			if !ok {
+				return nil
+			}
 			id := p.GetID()
-			tailsMutex.RLock()
-			existing := tails[id]
-			tailsMutex.RUnlock()
-			if existing != nil {
-				if existing.Active == true {
+			delete(unseen, id)
+			if r := retries[id]; r != nil {
+				if r.pending {
+					// the retry timer takes care of failing targets
 					continue
-				} else { // cleanup failed tail to restart
-					tailsMutex.Lock()
-					tails[id].Close()
-					delete(tails, id)
-					tailsMutex.Unlock()
 				}
+				// the container may have been recreated or recovered since
+				// giving up, start over with a new budget
+				delete(retries, id)
+			}
+			if existing := tails[id]; existing != nil {
+				if existing.Active {
+					continue
+				}
+				// cleanup failed tail to restart
+				existing.Close()
+				delete(tails, id)
+			}
+			startTail(p, false)
+
+		case t := <-openedC:
+			// the budget is for consecutive failures
+			id := (&Target{Namespace: t.Namespace, Pod: t.PodName, Container: t.ContainerName}).GetID()
+			if r := retries[id]; r != nil && tails[id] == t {
+				r.stop()
+				delete(retries, id)
+			}
+
+		case p, ok := <-removed:
+			if !ok {
+				return nil
+			}
+			id := p.GetID()
+			delete(fetched, id)
+			delete(unseen, id)
+			if r := retries[id]; r != nil {
+				r.stop()
+				delete(retries, id)
+			}
+			if existing := tails[id]; existing != nil {
+				existing.Close()
+				delete(tails, id)
+			}
+
+		case t := <-failedC:
+			p := &Target{Namespace: t.Namespace, Pod: t.PodName, Container: t.ContainerName}
+			id := p.GetID()
+			if tails[id] != t {
+				// removed in the meantime
+				continue
+			}
+			r := retries[id]
+			if r == nil {
+				r = &retryState{}
+				retries[id] = r
+			}
+			r.attempts++
+
+			err := t.Err()
+			if isPermanentError(err) {
+				r.gaveUp = true
+				printTailStatus(t, fmt.Sprintf("not retrying: %s", err))
+				continue
+			}
+			if config.Backoff.Exhausted(r.attempts) {
+				r.gaveUp = true
+				printTailStatus(t, fmt.Sprintf("giving up after %d retries: %s", r.attempts-1, err))
+				continue
 			}
-			tail := NewTail(p.Namespace, p.Pod, p.Container, config.Template, &TailOptions{
-				Timestamps:   config.Timestamps,
-				SinceSeconds: int64(config.Since.Seconds()),
-				Exclude:      config.Exclude,
-				Include:      config.Include,
-				Namespace:    config.AllNamespaces,
-				TailLines:    config.TailLines,
+
+			delay := config.Backoff.Delay(r.attempts)
+			budget := "∞"
+			if config.Backoff.MaxRetries >= 0 {
+				budget = fmt.Sprint(config.Backoff.MaxRetries)
+			}
+			printTailStatus(t, fmt.Sprintf("retrying in %s (attempt %d/%s): %s", delay.Round(100*time.Millisecond), r.attempts, budget, err))
+			r.pending = true
+			r.timer = time.AfterFunc(delay, func() {
+				select {
+				case retryC <- p:
+				case <-ctx.Done():
+				}
 			})
-			tailsMutex.Lock()
-			tails[id] = tail
-			tailsMutex.Unlock()
-			tail.Start(ctx, clientset.CoreV1().Pods(p.Namespace), logC)
-		}
-	}()
 
-	go func() {
-		for p := range removed {
+		case p := <-retryC:
 			id := p.GetID()
-			tailsMutex.RLock()
-			existing := tails[id]
-			tailsMutex.RUnlock()
-			if existing == nil {
+			r := retries[id]
+			if r == nil || !r.pending {
+				// removed in the meantime
 				continue
 			}
-			tailsMutex.Lock()
-			tails[id].Close()
-			delete(tails, id)
-			tailsMutex.Unlock()
+			r.pending = false
+			if existing := tails[id]; existing != nil {
+				existing.stop()
+				delete(tails, id)
+			}
+			startTail(p, true)
+
+		case <-ctx.Done():
+			return nil
 		}
-	}()
+	}
+}
 
-	<-ctx.Done()
+// drainTimeout bounds the time to wait for the tails to end once run was asked
+// to stop
+const drainTimeout = 10 * time.Second
 
-	return nil
+// newTail returns a tail for a target with the options from config
+func newTail(t *Target, config *Config) *Tail {
+	tail := NewTail(t.Namespace, t.Pod, t.Container, config.templateFor(t), &TailOptions{
+		Timestamps:   config.Timestamps,
+		SinceSeconds: int64(config.Since.Seconds()),
+		Exclude:      config.Exclude,
+		Include:      config.Include,
+		Namespace:    config.AllNamespaces,
+		TailLines:    config.TailLines,
+		LimitBytes:   config.LimitBytes,
+		Envelope:     config.Envelope,
+		Cluster:      config.Cluster,
+		Sidecar:      config.sidecarFor(t),
+		Headers:      config.Headers,
+		OnlyLogLines: config.OnlyLogLines,
+	})
+	tail.NodeName = t.Node
+	return tail
+}
+
+// printTailStatus prints a status message about a tail on stderr
+func printTailStatus(t *Tail, status string) {
+	y := color.New(color.FgHiYellow, color.Bold).SprintFunc()
+	p := t.podColor.SprintFunc()
+	c := t.containerColor.SprintFunc()
+	if t.Options.Namespace {
+		fmt.Fprintf(os.Stderr, "%s %s %s › %s %s\n", y("!"), p(t.Namespace), p(t.PodName), c(t.ContainerName), status)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s %s › %s %s\n", y("!"), p(t.PodName), c(t.ContainerName), status)
+	}
+}
+
+// newClientSet returns a clientset for the configured context and the
+// namespace to use, which is empty for all namespaces
+func newClientSet(config *Config) (*k8s.Clientset, string, error) {
+	clientset, err := kubernetes.NewClientSet(config.KubeConfig, config.ContextName, config.InCluster)
+	if err != nil {
+		return nil, "", err
+	}
+	namespace, err := configNamespace(config)
+	if err != nil {
+		return nil, "", err
+	}
+	return clientset, namespace, nil
+}
+
+// configNamespace returns the namespace to use, which is empty for all
+// namespaces, without connecting to the cluster
+func configNamespace(config *Config) (string, error) {
+	// A specific namespace is ignored if all-namespaces is provided
+	if config.AllNamespaces {
+		return "", nil
+	}
+	if config.Namespace != "" {
+		return config.Namespace, nil
+	}
+	return kubernetes.Namespace(config.KubeConfig, config.ContextName, config.InCluster)
 }
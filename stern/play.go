@@ -0,0 +1,384 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Record is a log read back from the JSON output
+type Record struct {
+	Log Log
+
+	// Time is when the message was logged, zero when unknown
+	Time time.Time
+}
+
+// ReadRecords reads the records of the JSON output of any version
+func ReadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record, err := parseRecord([]byte(line))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d", n)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read records")
+	}
+	return records, nil
+}
+
+// parseRecord parses a record of the JSON output. Records of version 0 only
+// have a time when they were saved with --timestamps.
+func parseRecord(line []byte) (*Record, error) {
+	var version struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(line, &version); err != nil {
+		return nil, err
+	}
+
+	if version.Version == nil {
+		var e envelopeV0
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+		ts, _ := splitTimestamp(e.Message)
+		return &Record{
+			Log: Log{
+				Message:       e.Message,
+				Namespace:     e.Namespace,
+				PodName:       e.PodName,
+				ContainerName: e.ContainerName,
+			},
+			Time: ts,
+		}, nil
+	}
+
+	var e EnvelopeV1
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, err
+	}
+	if *version.Version > JSONVersion {
+		return nil, errors.Errorf("unknown JSON output version %d", *version.Version)
+	}
+	record := &Record{Log: Log{
+		Namespace:     e.Namespace,
+		PodName:       e.Pod,
+		ContainerName: e.Container,
+		NodeName:      e.Node,
+		Cluster:       e.Cluster,
+		Stream:        e.Stream,
+	}}
+	if e.Type == EventLog {
+		record.Log.Message = e.Message + "\n"
+	} else {
+		record.Log.Event = e.Type
+	}
+	if e.Timestamp != "" {
+		ts, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse timestamp")
+		}
+		record.Time = ts
+	}
+	return record, nil
+}
+
+// PlayAction is something to do while playing
+type PlayAction int
+
+// The actions while playing
+const (
+	PlayTogglePause PlayAction = iota
+	PlayFaster
+	PlaySlower
+	PlaySeek
+	PlayFilter
+)
+
+// PlayControl changes the playback
+type PlayControl struct {
+	Action PlayAction
+
+	// Time is where PlaySeek goes to. When it is zero, Offset is added to
+	// the time of the current record instead.
+	Time   time.Time
+	Offset time.Duration
+
+	// Filter is the regular expression the messages shown after PlayFilter
+	// have to match, nil to show every message
+	Filter *regexp.Regexp
+}
+
+// PlaySpeeds are the speeds PlayFaster and PlaySlower step through
+var PlaySpeeds = []float64{0.5, 1, 2, 5, 10, 25, 50, 100}
+
+// untimedInterval is the time between records without timestamps at 1x
+const untimedInterval = 100 * time.Millisecond
+
+// Player plays records with the timing they were logged with
+type Player struct {
+	Records []*Record
+
+	// Speed multiplies the pace of the records
+	Speed float64
+
+	// MaxGap bounds the time waited between two records at 1x
+	MaxGap time.Duration
+
+	// Start is the time to start playing at, zero for the first record
+	Start time.Time
+
+	// Status receives messages about the playback when set
+	Status io.Writer
+
+	config *Config
+	tails  map[string]*Tail
+	filter *regexp.Regexp
+	after  func(time.Duration) <-chan time.Time
+}
+
+// NewPlayer returns a player showing the records matching the queries and
+// filters of config with its templates
+func NewPlayer(records []*Record, config *Config) *Player {
+	return &Player{
+		Records: records,
+		Speed:   1,
+		MaxGap:  5 * time.Second,
+		config:  config,
+		tails:   make(map[string]*Tail),
+		after:   time.After,
+	}
+}
+
+// Play writes the records to out until the last one was played or ctx is
+// done, applying the controls received in the meantime
+func (p *Player) Play(ctx context.Context, out io.Writer, controls <-chan PlayControl) error {
+	if p.config.Trace {
+		trace := newTraceWriter(out)
+		defer trace.Close()
+		out = trace
+	}
+
+	paused := false
+	pos := 0
+	if !p.Start.IsZero() {
+		pos = p.seek(0, PlayControl{Action: PlaySeek, Time: p.Start})
+	}
+	for pos < len(p.Records) {
+		var next <-chan time.Time
+		if !paused {
+			next = p.after(p.delay(pos))
+		}
+
+		select {
+		case <-next:
+			io.WriteString(out, p.print(p.Records[pos]))
+			pos++
+
+		case c := <-controls:
+			switch c.Action {
+			case PlayTogglePause:
+				paused = !paused
+				if paused {
+					p.status("paused at %s", p.describe(pos))
+				} else {
+					p.status("playing at %gx", p.Speed)
+				}
+			case PlayFaster, PlaySlower:
+				p.Speed = stepSpeed(p.Speed, c.Action == PlayFaster)
+				p.status("playing at %gx", p.Speed)
+			case PlaySeek:
+				pos = p.seek(pos, c)
+				p.status("at %s", p.describe(pos))
+			case PlayFilter:
+				p.filter = c.Filter
+				if c.Filter == nil {
+					p.status("showing every message")
+				} else {
+					p.status("showing messages matching %s", c.Filter)
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// delay returns the time to wait before playing the record at pos
+func (p *Player) delay(pos int) time.Duration {
+	if pos == 0 {
+		return 0
+	}
+	prev, cur := p.Records[pos-1].Time, p.Records[pos].Time
+	d := untimedInterval
+	if !prev.IsZero() && !cur.IsZero() {
+		d = cur.Sub(prev)
+		if d < 0 {
+			d = 0
+		}
+		if p.MaxGap > 0 && d > p.MaxGap {
+			d = p.MaxGap
+		}
+	}
+	return time.Duration(float64(d) / p.Speed)
+}
+
+// stepSpeed returns the next speed of PlaySpeeds after speed
+func stepSpeed(speed float64, faster bool) float64 {
+	if faster {
+		for _, s := range PlaySpeeds {
+			if s > speed {
+				return s
+			}
+		}
+		return PlaySpeeds[len(PlaySpeeds)-1]
+	}
+	for i := len(PlaySpeeds) - 1; i >= 0; i-- {
+		if PlaySpeeds[i] < speed {
+			return PlaySpeeds[i]
+		}
+	}
+	return PlaySpeeds[0]
+}
+
+// seek returns the position of the first record logged at or after the time
+// of a seek control
+func (p *Player) seek(pos int, c PlayControl) int {
+	target := c.Time
+	if target.IsZero() {
+		current := p.timeAt(pos)
+		if current.IsZero() {
+			p.status("can't seek without timestamps")
+			return pos
+		}
+		target = current.Add(c.Offset)
+	}
+	for i, r := range p.Records {
+		if !r.Time.IsZero() && !r.Time.Before(target) {
+			return i
+		}
+	}
+	return len(p.Records)
+}
+
+// timeAt returns the time of the record at pos, or of the closest one before
+// it which has a time
+func (p *Player) timeAt(pos int) time.Time {
+	if pos >= len(p.Records) {
+		pos = len(p.Records) - 1
+	}
+	for i := pos; i >= 0; i-- {
+		if t := p.Records[i].Time; !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// describe returns the time of the record at pos, or its number
+func (p *Player) describe(pos int) string {
+	if pos >= len(p.Records) {
+		return "the end"
+	}
+	if t := p.timeAt(pos); !t.IsZero() {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("record %d/%d", pos+1, len(p.Records))
+}
+
+func (p *Player) status(format string, args ...interface{}) {
+	if p.Status != nil {
+		fmt.Fprintf(p.Status, "-- "+format+" --\n", args...)
+	}
+}
+
+// print returns a record as it would have been printed when tailing, or an
+// empty string when it's filtered out
+func (p *Player) print(r *Record) string {
+	target := &Target{Namespace: r.Log.Namespace, Pod: r.Log.PodName, Container: r.Log.ContainerName, Node: r.Log.NodeName}
+	if !p.selects(target) {
+		return ""
+	}
+
+	tail := p.tails[target.GetID()]
+	if tail == nil {
+		tail = newTail(target, p.config)
+		tail.Options.Cluster = r.Log.Cluster
+		tail.podColor, tail.containerColor = determineColor(target.Pod)
+		p.tails[target.GetID()] = tail
+	}
+
+	switch r.Log.Event {
+	case "":
+	case EventAdded, EventRemoved:
+		if p.filter != nil || len(p.config.Include) > 0 {
+			return ""
+		}
+		if tail.Options.Envelope {
+			return tail.printEvent(r.Log.Event)
+		}
+		if r.Log.Event == EventAdded {
+			return tail.addedMarker()
+		}
+		return tail.removedMarker()
+	default:
+		return ""
+	}
+
+	msg := r.Log.Message
+	if !tail.Options.matches(msg) || (p.filter != nil && !p.filter.MatchString(msg)) {
+		return ""
+	}
+	return tail.printTimed(r.Time, msg)
+}
+
+// selects returns true when the queries of the config match a target
+func (p *Player) selects(t *Target) bool {
+	c := p.config
+	if c.Namespace != "" && !c.AllNamespaces && t.Namespace != c.Namespace {
+		return false
+	}
+	if c.PodQuery != nil && !c.PodQuery.MatchString(t.Pod) {
+		return false
+	}
+	if c.ContainerQuery != nil && !c.ContainerQuery.MatchString(t.Container) {
+		return false
+	}
+	if c.ExcludeContainerQuery != nil && c.ExcludeContainerQuery.MatchString(t.Container) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+const playRecords = `{"message":"2019-06-20T10:00:00Z started\n","namespace":"ns","podName":"api","containerName":"app"}
+
+{"version":1,"type":"added","namespace":"ns","pod":"web","container":"nginx"}
+{"version":1,"type":"log","timestamp":"2019-06-20T10:00:02Z","namespace":"ns","pod":"web","container":"nginx","message":"GET /"}
+{"version":1,"type":"log","timestamp":"2019-06-20T10:01:00Z","namespace":"ns","pod":"api","container":"app","message":"failed"}
+`
+
+func readPlayRecords(t *testing.T) []*Record {
+	records, err := ReadRecords(strings.NewReader(playRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestReadRecords(t *testing.T) {
+	records := readPlayRecords(t)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	start := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+	if r := records[0]; r.Log.PodName != "api" || r.Log.Message != "2019-06-20T10:00:00Z started\n" || !r.Time.Equal(start) {
+		t.Errorf("unexpected version 0 record %+v", r)
+	}
+	if r := records[1]; r.Log.Event != EventAdded || !r.Time.IsZero() {
+		t.Errorf("unexpected event record %+v", r)
+	}
+	if r := records[2]; r.Log.ContainerName != "nginx" || r.Log.Message != "GET /\n" || !r.Time.Equal(start.Add(2*time.Second)) {
+		t.Errorf("unexpected version 1 record %+v", r)
+	}
+
+	if _, err := ReadRecords(strings.NewReader("{\"version\":1}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func newTestPlayer(t *testing.T, config *Config) *Player {
+	config.Template = template.Must(template.New("").Parse("{{.PodName}} {{.Message}}"))
+	p := NewPlayer(readPlayRecords(t), config)
+	p.after = func(time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Time{}
+		return c
+	}
+	return p
+}
+
+func TestPlay(t *testing.T) {
+	p := newTestPlayer(t, &Config{Exclude: []*regexp.Regexp{regexp.MustCompile("GET")}})
+	var out bytes.Buffer
+	if err := p.Play(context.Background(), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := "api 2019-06-20T10:00:00Z started\n+ web › nginx\napi failed\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	p = newTestPlayer(t, &Config{PodQuery: regexp.MustCompile("^api$")})
+	p.Start = time.Date(2019, 6, 20, 10, 0, 1, 0, time.UTC)
+	out.Reset()
+	p.Play(context.Background(), &out, nil)
+	if out.String() != "api failed\n" {
+		t.Errorf("expected to start after the first record, got %q", out.String())
+	}
+}
+
+func TestPlayDelay(t *testing.T) {
+	p := newTestPlayer(t, &Config{})
+	p.MaxGap = 10 * time.Second
+	p.Speed = 2
+
+	tests := []struct {
+		pos      int
+		expected time.Duration
+	}{
+		{0, 0},
+		{1, untimedInterval / 2},
+		{2, untimedInterval / 2},
+		{3, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if d := p.delay(tt.pos); d != tt.expected {
+			t.Errorf("%d: expected %s, got %s", tt.pos, tt.expected, d)
+		}
+	}
+}
+
+func TestPlaySeek(t *testing.T) {
+	p := newTestPlayer(t, &Config{})
+	start := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pos      int
+		control  PlayControl
+		expected int
+	}{
+		{0, PlayControl{Time: start.Add(time.Second)}, 2},
+		{0, PlayControl{Time: start.Add(time.Hour)}, 4},
+		{1, PlayControl{Offset: 10 * time.Second}, 3},
+		{3, PlayControl{Offset: -time.Minute}, 0},
+	}
+	for i, tt := range tests {
+		if pos := p.seek(tt.pos, tt.control); pos != tt.expected {
+			t.Errorf("%d: expected position %d, got %d", i, tt.expected, pos)
+		}
+	}
+}
+
+func TestStepSpeed(t *testing.T) {
+	tests := []struct {
+		speed    float64
+		faster   bool
+		expected float64
+	}{
+		{1, true, 2},
+		{1, false, 0.5},
+		{3, true, 5},
+		{3, false, 2},
+		{100, true, 100},
+		{0.5, false, 0.5},
+	}
+	for _, tt := range tests {
+		if s := stepSpeed(tt.speed, tt.faster); s != tt.expected {
+			t.Errorf("%g faster=%t: expected %g, got %g", tt.speed, tt.faster, tt.expected, s)
+		}
+	}
+}
+
+func TestPlayFilter(t *testing.T) {
+	p := newTestPlayer(t, &Config{})
+	p.filter = regexp.MustCompile("fail")
+	if s := p.print(p.Records[1]); s != "" {
+		t.Errorf("expected events to be hidden while filtering, got %q", s)
+	}
+	if s := p.print(p.Records[2]); s != "" {
+		t.Errorf("expected %q to be filtered out", s)
+	}
+	if s := p.print(p.Records[3]); s != "api failed\n" {
+		t.Errorf("expected the matching message, got %q", s)
+	}
+}
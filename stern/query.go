@@ -0,0 +1,630 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Query dialects
+const (
+	// QueryLogQL queries Loki, with the labels of promtail's Kubernetes
+	// service discovery
+	QueryLogQL = "logql"
+
+	// QueryKQL queries Kibana, with the fields of Filebeat's Kubernetes
+	// metadata
+	QueryKQL = "kql"
+
+	// QueryES queries Elasticsearch with the query DSL, with the fields of
+	// Filebeat's Kubernetes metadata
+	QueryES = "es"
+)
+
+// Fields of Filebeat's Kubernetes metadata
+const (
+	esNamespace = "kubernetes.namespace"
+	esPod       = "kubernetes.pod.name"
+	esContainer = "kubernetes.container.name"
+	esLabels    = "kubernetes.labels."
+	esMessage   = "message"
+)
+
+// Query translates the namespace, the pod, container and label queries and
+// the include and exclude filters of config into a query of dialect, to run
+// the same search on the history kept by a logging backend. Only resource
+// queries need the cluster, the namespace is otherwise read from config or the
+// kubeconfig.
+func Query(config *Config, dialect string) (string, error) {
+	if config.ResourceQuery == nil {
+		namespace, err := configNamespace(config)
+		if err != nil {
+			return "", err
+		}
+		return query(config, namespace, dialect)
+	}
+
+	clientset, namespace, err := newClientSet(config)
+	if err != nil {
+		return "", err
+	}
+	config, namespace, err = resolve(clientset, namespace, config)
+	if err != nil {
+		return "", err
+	}
+	return query(config, namespace, dialect)
+}
+
+// query translates config tailing namespace, empty for all namespaces
+func query(config *Config, namespace string, dialect string) (string, error) {
+	var requirements labels.Requirements
+	if config.LabelSelector != nil {
+		requirements, _ = config.LabelSelector.Requirements()
+	}
+
+	switch dialect {
+	case QueryLogQL:
+		return logQL(config, namespace, requirements)
+	case QueryKQL:
+		return kql(config, namespace, requirements)
+	case QueryES:
+		return esQuery(config, namespace, requirements)
+	default:
+		return "", errors.Errorf("query dialect should be one of '%s', '%s' or '%s'", QueryLogQL, QueryKQL, QueryES)
+	}
+}
+
+// matchesAll returns true when a query is missing or matches everything
+func matchesAll(re *regexp.Regexp) bool {
+	return re == nil || re.String() == "" || re.String() == ".*"
+}
+
+// logQL returns a LogQL query. Label matchers are anchored, line filters
+// aren't.
+func logQL(config *Config, namespace string, requirements labels.Requirements) (string, error) {
+	var matchers []string
+	if namespace != "" {
+		matchers = append(matchers, "namespace="+strconv.Quote(namespace))
+	}
+	if !matchesAll(config.PodQuery) {
+		matchers = append(matchers, "pod=~"+logQLString(anchored(config.PodQuery)))
+	}
+	if !matchesAll(config.ContainerQuery) {
+		matchers = append(matchers, "container=~"+logQLString(anchored(config.ContainerQuery)))
+	}
+	if config.ExcludeContainerQuery != nil {
+		matchers = append(matchers, "container!~"+logQLString(anchored(config.ExcludeContainerQuery)))
+	}
+
+	for _, r := range requirements {
+		name := logQLLabel(r.Key())
+		values := r.Values().List()
+		// only the alternations are regular expressions
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = regexp.QuoteMeta(v)
+		}
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals:
+			matchers = append(matchers, name+"="+strconv.Quote(values[0]))
+		case selection.NotEquals:
+			matchers = append(matchers, name+"!="+strconv.Quote(values[0]))
+		case selection.In:
+			matchers = append(matchers, name+"=~"+logQLString(strings.Join(quoted, "|")))
+		case selection.NotIn:
+			matchers = append(matchers, name+"!~"+logQLString(strings.Join(quoted, "|")))
+		case selection.Exists:
+			matchers = append(matchers, name+`=~".+"`)
+		case selection.DoesNotExist:
+			matchers = append(matchers, name+`=""`)
+		default:
+			return "", errors.Errorf("label requirement %s can't be expressed in LogQL", r.String())
+		}
+	}
+
+	// a stream selector needs a matcher which doesn't match empty labels
+	if namespace == "" {
+		matchers = append([]string{`namespace=~".+"`}, matchers...)
+	}
+
+	q := "{" + strings.Join(matchers, ", ") + "}"
+	if len(config.Include) > 0 {
+		var include []string
+		for _, rin := range config.Include {
+			include = append(include, rin.String())
+		}
+		if len(include) == 1 {
+			q += " |~ " + logQLString(include[0])
+		} else {
+			q += " |~ " + logQLString("(?:"+strings.Join(include, ")|(?:")+")")
+		}
+	}
+	for _, rex := range config.Exclude {
+		q += " !~ " + logQLString(rex.String())
+	}
+	return q, nil
+}
+
+// logQLString quotes a regex, preferring raw strings
+func logQLString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// logQLLabel returns the label promtail makes of a pod label
+func logQLLabel(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// anchored returns a regex matching the whole strings in which re matches a
+// substring, for backends anchoring their regexes
+func anchored(re *regexp.Regexp) string {
+	s := re.String()
+	tree, err := syntax.Parse(s, syntax.Perl)
+	if err != nil {
+		return s
+	}
+
+	prefix, suffix := ".*", ".*"
+	if tree.Op == syntax.OpConcat {
+		subs := tree.Sub
+		if subs[0].Op == syntax.OpBeginText && strings.HasPrefix(s, "^") {
+			s = s[1:]
+			prefix = ""
+		}
+		if subs[len(subs)-1].Op == syntax.OpEndText && strings.HasSuffix(s, "$") {
+			s = s[:len(s)-1]
+			suffix = ""
+		}
+	}
+	if tree.Op == syntax.OpAlternate && (prefix != "" || suffix != "") {
+		s = "(?:" + s + ")"
+	}
+	return prefix + s + suffix
+}
+
+// kql returns a Kibana query. Pod and container names are matched with
+// wildcards, and messages with phrases, so only regexes made of literals and
+// .* can be translated.
+func kql(config *Config, namespace string, requirements labels.Requirements) (string, error) {
+	var clauses []string
+	if namespace != "" {
+		clauses = append(clauses, esNamespace+": "+strconv.Quote(namespace))
+	}
+	if !matchesAll(config.PodQuery) {
+		w, err := wildcard(config.PodQuery)
+		if err != nil {
+			return "", errors.Wrap(err, "pod query")
+		}
+		clauses = append(clauses, esPod+": "+w)
+	}
+	if !matchesAll(config.ContainerQuery) {
+		w, err := wildcard(config.ContainerQuery)
+		if err != nil {
+			return "", errors.Wrap(err, "container query")
+		}
+		clauses = append(clauses, esContainer+": "+w)
+	}
+	if config.ExcludeContainerQuery != nil {
+		w, err := wildcard(config.ExcludeContainerQuery)
+		if err != nil {
+			return "", errors.Wrap(err, "exclude container query")
+		}
+		clauses = append(clauses, "not "+esContainer+": "+w)
+	}
+
+	for _, r := range requirements {
+		field := esLabels + esLabel(r.Key())
+		var values []string
+		for _, v := range r.Values().List() {
+			values = append(values, strconv.Quote(v))
+		}
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			clauses = append(clauses, field+": "+kqlAny(values))
+		case selection.NotEquals, selection.NotIn:
+			clauses = append(clauses, "not "+field+": "+kqlAny(values))
+		case selection.Exists:
+			clauses = append(clauses, field+": *")
+		case selection.DoesNotExist:
+			clauses = append(clauses, "not "+field+": *")
+		default:
+			return "", errors.Errorf("label requirement %s can't be expressed in KQL", r.String())
+		}
+	}
+
+	var include []string
+	for _, rin := range config.Include {
+		phrase, err := literal(rin)
+		if err != nil {
+			return "", errors.Wrap(err, "include filter")
+		}
+		include = append(include, strconv.Quote(phrase))
+	}
+	if len(include) > 0 {
+		clauses = append(clauses, esMessage+": "+kqlAny(include))
+	}
+	for _, rex := range config.Exclude {
+		phrase, err := literal(rex)
+		if err != nil {
+			return "", errors.Wrap(err, "exclude filter")
+		}
+		clauses = append(clauses, "not "+esMessage+": "+strconv.Quote(phrase))
+	}
+
+	if len(clauses) == 0 {
+		return "*", nil
+	}
+	return strings.Join(clauses, " and "), nil
+}
+
+// kqlAny returns a KQL value matching any of values
+func kqlAny(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "(" + strings.Join(values, " or ") + ")"
+}
+
+// esLabel returns the field Filebeat makes of a pod label
+func esLabel(key string) string {
+	return strings.NewReplacer(".", "_", "/", "_").Replace(key)
+}
+
+// wildcard translates a regex made of literals and .* into a KQL wildcard
+// pattern
+func wildcard(re *regexp.Regexp) (string, error) {
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	subs := []*syntax.Regexp{tree}
+	if tree.Op == syntax.OpConcat {
+		subs = tree.Sub
+	}
+
+	var b strings.Builder
+	if subs[0].Op == syntax.OpBeginText {
+		subs = subs[1:]
+	} else {
+		b.WriteString("*")
+	}
+	end := len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText
+	if end {
+		subs = subs[:len(subs)-1]
+	}
+
+	for _, sub := range subs {
+		switch {
+		case sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0:
+			for _, r := range sub.Rune {
+				if strings.ContainsRune(`\():<>"*{} `, r) {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(r)
+			}
+		case sub.Op == syntax.OpStar && (sub.Sub[0].Op == syntax.OpAnyCharNotNL || sub.Sub[0].Op == syntax.OpAnyChar):
+			b.WriteString("*")
+		default:
+			return "", errors.Errorf("%q can't be expressed with wildcards", re.String())
+		}
+	}
+	if !end {
+		b.WriteString("*")
+	}
+	return strings.Replace(b.String(), "**", "*", -1), nil
+}
+
+// literal returns the text matched by a regex which is a plain literal
+func literal(re *regexp.Regexp) (string, error) {
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	if tree.Op != syntax.OpLiteral || tree.Flags&syntax.FoldCase != 0 {
+		return "", errors.Errorf("%q can't be expressed as a phrase", re.String())
+	}
+	return string(tree.Rune), nil
+}
+
+// esQuery returns an Elasticsearch query. Regexes are translated into the
+// Lucene regular expression syntax, and messages which are literals are
+// matched as phrases.
+func esQuery(config *Config, namespace string, requirements labels.Requirements) (string, error) {
+	var filter, mustNot, should []interface{}
+
+	if namespace != "" {
+		filter = append(filter, term(esNamespace, namespace))
+	}
+	regexps := []struct {
+		name  string
+		field string
+		re    *regexp.Regexp
+		not   bool
+	}{
+		{"pod query", esPod, config.PodQuery, false},
+		{"container query", esContainer, config.ContainerQuery, false},
+		{"exclude container query", esContainer, config.ExcludeContainerQuery, true},
+	}
+	for _, r := range regexps {
+		if r.re == nil || (!r.not && matchesAll(r.re)) {
+			continue
+		}
+		l, err := lucene(r.re)
+		if err != nil {
+			return "", errors.Wrap(err, r.name)
+		}
+		q := map[string]interface{}{"regexp": map[string]interface{}{r.field: l}}
+		if r.not {
+			mustNot = append(mustNot, q)
+		} else {
+			filter = append(filter, q)
+		}
+	}
+
+	for _, r := range requirements {
+		field := esLabels + esLabel(r.Key())
+		values := r.Values().List()
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			filter = append(filter, terms(field, values))
+		case selection.NotEquals, selection.NotIn:
+			mustNot = append(mustNot, terms(field, values))
+		case selection.Exists:
+			filter = append(filter, exists(field))
+		case selection.DoesNotExist:
+			mustNot = append(mustNot, exists(field))
+		default:
+			return "", errors.Errorf("label requirement %s can't be expressed in Elasticsearch", r.String())
+		}
+	}
+
+	for _, rin := range config.Include {
+		q, err := messageQuery(rin)
+		if err != nil {
+			return "", errors.Wrap(err, "include filter")
+		}
+		should = append(should, q)
+	}
+	for _, rex := range config.Exclude {
+		q, err := messageQuery(rex)
+		if err != nil {
+			return "", errors.Wrap(err, "exclude filter")
+		}
+		mustNot = append(mustNot, q)
+	}
+
+	boolQuery := make(map[string]interface{})
+	if len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	if len(should) > 0 {
+		boolQuery["should"] = should
+		boolQuery["minimum_should_match"] = 1
+	}
+
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"query": map[string]interface{}{"bool": boolQuery},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func term(field, value string) interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+func terms(field string, values []string) interface{} {
+	if len(values) == 1 {
+		return term(field, values[0])
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{field: values}}
+}
+
+func exists(field string) interface{} {
+	return map[string]interface{}{"exists": map[string]interface{}{"field": field}}
+}
+
+// messageQuery matches messages with a phrase when re is a literal, and with
+// a regexp otherwise
+func messageQuery(re *regexp.Regexp) (interface{}, error) {
+	if phrase, err := literal(re); err == nil {
+		return map[string]interface{}{"match_phrase": map[string]interface{}{esMessage: phrase}}, nil
+	}
+	l, err := lucene(re)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"regexp": map[string]interface{}{esMessage: l}}, nil
+}
+
+// lucene translates a regex into the Lucene regular expression syntax, which
+// is always anchored and lacks Perl classes, flags and assertions
+func lucene(re *regexp.Regexp) (string, error) {
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+
+	prefix, suffix := ".*", ".*"
+	if tree.Op == syntax.OpConcat {
+		subs := tree.Sub
+		if subs[0].Op == syntax.OpBeginText {
+			subs = subs[1:]
+			prefix = ""
+		}
+		if len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText {
+			subs = subs[:len(subs)-1]
+			suffix = ""
+		}
+		tree = &syntax.Regexp{Op: syntax.OpConcat, Sub: subs}
+	}
+
+	var b strings.Builder
+	if err := writeLucene(&b, tree); err != nil {
+		return "", errors.Wrapf(err, "%q can't be expressed in Lucene", re.String())
+	}
+	s := b.String()
+	if tree.Op == syntax.OpAlternate && (prefix != "" || suffix != "") {
+		s = "(" + s + ")"
+	}
+	return prefix + s + suffix, nil
+}
+
+// luceneReserved are the characters to escape in Lucene regular expressions
+const luceneReserved = `.?+*|{}[]()"\#@&<>~`
+
+func writeLucene(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && unicode.ToUpper(r) != unicode.ToLower(r) {
+				fmt.Fprintf(b, "[%c%c]", unicode.ToLower(r), unicode.ToUpper(r))
+				continue
+			}
+			if strings.ContainsRune(luceneReserved, r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		ranges := re.Rune
+		// negated classes range up to the last rune
+		negated := len(ranges) > 0 && ranges[len(ranges)-1] == unicode.MaxRune
+		if negated {
+			ranges = negate(ranges)
+			if len(ranges) == 0 {
+				b.WriteString(".")
+				break
+			}
+			b.WriteString("[^")
+		} else {
+			b.WriteString("[")
+		}
+		for i := 0; i < len(ranges); i += 2 {
+			writeClassRune(b, ranges[i])
+			if ranges[i+1] != ranges[i] {
+				b.WriteString("-")
+				writeClassRune(b, ranges[i+1])
+			}
+		}
+		b.WriteString("]")
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteString(".")
+	case syntax.OpCapture:
+		b.WriteString("(")
+		if err := writeLucene(b, re.Sub[0]); err != nil {
+			return err
+		}
+		b.WriteString(")")
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if err := writeLuceneAtom(b, re.Sub[0]); err != nil {
+			return err
+		}
+		switch re.Op {
+		case syntax.OpStar:
+			b.WriteString("*")
+		case syntax.OpPlus:
+			b.WriteString("+")
+		case syntax.OpQuest:
+			b.WriteString("?")
+		default:
+			if re.Max == -1 {
+				fmt.Fprintf(b, "{%d,}", re.Min)
+			} else if re.Max == re.Min {
+				fmt.Fprintf(b, "{%d}", re.Min)
+			} else {
+				fmt.Fprintf(b, "{%d,%d}", re.Min, re.Max)
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			group := sub.Op == syntax.OpAlternate
+			if group {
+				b.WriteString("(")
+			}
+			if err := writeLucene(b, sub); err != nil {
+				return err
+			}
+			if group {
+				b.WriteString(")")
+			}
+		}
+	case syntax.OpAlternate:
+		for i, sub := range re.Sub {
+			if i > 0 {
+				b.WriteString("|")
+			}
+			if err := writeLucene(b, sub); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unsupported %s", re)
+	}
+	return nil
+}
+
+// writeLuceneAtom writes re, grouped when it is made of several parts
+func writeLuceneAtom(b *strings.Builder, re *syntax.Regexp) error {
+	if re.Op == syntax.OpAlternate || re.Op == syntax.OpConcat || (re.Op == syntax.OpLiteral && len(re.Rune) > 1) {
+		b.WriteString("(")
+		defer b.WriteString(")")
+	}
+	return writeLucene(b, re)
+}
+
+func writeClassRune(b *strings.Builder, r rune) {
+	if strings.ContainsRune(`[]\^-`, r) {
+		b.WriteRune('\\')
+	}
+	b.WriteRune(r)
+}
+
+// negate returns the complement of sorted ranges ending with unicode.MaxRune
+func negate(ranges []rune) []rune {
+	var out []rune
+	next := rune(0)
+	for i := 0; i < len(ranges); i += 2 {
+		if ranges[i] > next {
+			out = append(out, next, ranges[i]-1)
+		}
+		next = ranges[i+1] + 1
+	}
+	return out
+}
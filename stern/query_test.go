@@ -0,0 +1,158 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func queryConfig(t *testing.T, selector string) *Config {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Config{
+		PodQuery:              regexp.MustCompile("^web-"),
+		ContainerQuery:        regexp.MustCompile(".*"),
+		ExcludeContainerQuery: regexp.MustCompile("istio-proxy"),
+		LabelSelector:         s,
+		Include:               []*regexp.Regexp{regexp.MustCompile("error"), regexp.MustCompile("timeout")},
+		Exclude:               []*regexp.Regexp{regexp.MustCompile("healthz")},
+	}
+}
+
+func TestQueryLogQL(t *testing.T) {
+	q, err := query(queryConfig(t, "app.kubernetes.io/name=web,tier in (a,b),!canary"), "shop", QueryLogQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{namespace=\"shop\", pod=~`web-.*`, container!~`.*istio-proxy.*`, app_kubernetes_io_name=\"web\", canary=\"\", tier=~`a|b`} |~ `(?:error)|(?:timeout)` !~ `healthz`"
+	if q != expected {
+		t.Errorf("expected %s, got %s", expected, q)
+	}
+
+	config := &Config{PodQuery: regexp.MustCompile("a|b$"), LabelSelector: labels.Everything()}
+	q, err = query(config, "", QueryLogQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{namespace=~\".+\", pod=~`.*(?:a|b$).*`}"; q != expected {
+		t.Errorf("expected %s, got %s", expected, q)
+	}
+
+	// values are only escaped in regular expressions
+	q, err = query(queryConfig(t, "version=1.2.3,track!=v1.0,release in (1.2,1.3)"), "shop", QueryLogQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "{namespace=\"shop\", pod=~`web-.*`, container!~`.*istio-proxy.*`, release=~`1\\.2|1\\.3`, track!=\"v1.0\", version=\"1.2.3\"} |~ `(?:error)|(?:timeout)` !~ `healthz`"
+	if q != expected {
+		t.Errorf("expected %s, got %s", expected, q)
+	}
+}
+
+func TestQueryKQL(t *testing.T) {
+	q, err := query(queryConfig(t, "app=web,tier!=db"), "shop", QueryKQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `kubernetes.namespace: "shop" and kubernetes.pod.name: web-* and not kubernetes.container.name: *istio-proxy* and kubernetes.labels.app: "web" and not kubernetes.labels.tier: "db" and message: ("error" or "timeout") and not message: "healthz"`
+	if q != expected {
+		t.Errorf("expected %s, got %s", expected, q)
+	}
+
+	config := queryConfig(t, "")
+	config.PodQuery = regexp.MustCompile(`web-\d+`)
+	if _, err := query(config, "shop", QueryKQL); err == nil {
+		t.Errorf("expected an error for a pod query which isn't a wildcard")
+	}
+}
+
+func TestQueryES(t *testing.T) {
+	q, err := query(queryConfig(t, "app=web"), "", QueryES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"kubernetes.pod.name": "web-.*"`,
+		`"kubernetes.container.name": ".*istio-proxy.*"`,
+		`"kubernetes.labels.app": "web"`,
+		`"minimum_should_match": 1`,
+		`"message": "healthz"`,
+	} {
+		if !strings.Contains(q, expected) {
+			t.Errorf("expected %s in %s", expected, q)
+		}
+	}
+	if strings.Contains(q, "kubernetes.namespace") {
+		t.Errorf("expected no namespace filter for all namespaces")
+	}
+}
+
+func TestLucene(t *testing.T) {
+	tests := []struct {
+		re       string
+		expected string
+	}{
+		{`^web-\d+$`, `web-[0-9]+`},
+		{`error|warn`, `.*(error|warn).*`},
+		{`^(api|web)-[^a-z]{2,3}`, `(api|web)-[^a-z]{2,3}.*`},
+		{`a.b?(?:cd)*$`, `.*a.b?(cd)*`},
+		{`(?i)ok`, `.*[oO][kK].*`},
+		{`user@example\.com`, `.*user\@example\.com.*`},
+	}
+
+	for _, tt := range tests {
+		actual, err := lucene(regexp.MustCompile(tt.re))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.re, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.re, tt.expected, actual)
+		}
+	}
+
+	if _, err := lucene(regexp.MustCompile(`\bword\b`)); err == nil {
+		t.Errorf("expected an error for word boundaries")
+	}
+}
+
+func TestQueryWithoutCluster(t *testing.T) {
+	config := queryConfig(t, "app=web")
+	config.KubeConfig = "/nonexistent"
+	config.Namespace = "shop"
+	q, err := Query(config, QueryLogQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(q, `{namespace="shop", `) {
+		t.Errorf("expected a query of the shop namespace, got %s", q)
+	}
+
+	config.Namespace = ""
+	config.AllNamespaces = true
+	q, err = Query(config, QueryLogQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(q, `{namespace=~".+", `) {
+		t.Errorf("expected a query of all namespaces, got %s", q)
+	}
+}
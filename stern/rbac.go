@@ -0,0 +1,177 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RBACOptions describes the objects printed by RBAC
+type RBACOptions struct {
+	// Name of the roles and bindings
+	Name string
+
+	// Subjects granted the roles
+	Subjects []rbacv1.Subject
+
+	// EstimateVolume grants reading the log usage from the kubelets, needed
+	// to estimate the amount of logs before fetching them
+	EstimateVolume bool
+}
+
+// rbacRules returns the rules needed in the targeted namespaces and the rules
+// needed cluster-wide by config
+func rbacRules(config *Config, estimate bool) (namespaced, cluster []rbacv1.PolicyRule) {
+	namespaced = []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list", "watch"}},
+		{APIGroups: []string{""}, Resources: []string{"pods/log"}, Verbs: []string{"get"}},
+	}
+	if config.RedactSecrets {
+		namespaced = append(namespaced,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get"}})
+	}
+
+	if config.ResourceQuery != nil {
+		switch config.ResourceQuery.Kind {
+		case KindJob:
+			namespaced = append(namespaced,
+				rbacv1.PolicyRule{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: []string{"get"}})
+		case KindIP:
+			cluster = append(cluster,
+				rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}})
+		}
+	}
+
+	if estimate {
+		cluster = append(cluster,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes/proxy"}, Verbs: []string{"get"}})
+	}
+
+	return namespaced, cluster
+}
+
+// clusterWide returns true when config tails pods in any namespace
+func (c *Config) clusterWide() bool {
+	return c.AllNamespaces || (c.ResourceQuery != nil && c.ResourceQuery.Kind == KindIP)
+}
+
+// RBAC returns the YAML of the Role or ClusterRole and of its binding
+// granting the subjects what tailing config needs, and nothing more
+func RBAC(config *Config, options RBACOptions) (string, error) {
+	if options.Name == "" {
+		return "", errors.New("name of the roles must not be empty")
+	}
+	if len(options.Subjects) == 0 {
+		return "", errors.New("at least one subject is required")
+	}
+
+	namespaced, cluster := rbacRules(config, options.EstimateVolume)
+
+	var objects []runtime.Object
+	if config.clusterWide() {
+		objects = append(objects, clusterRole(options, append(namespaced, cluster...))...)
+	} else {
+		if config.Namespace == "" {
+			return "", errors.New("namespace must not be empty")
+		}
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: options.Name, Namespace: config.Namespace},
+				Rules:      namespaced,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: options.Name, Namespace: config.Namespace},
+				Subjects:   options.Subjects,
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: options.Name},
+			})
+		if len(cluster) > 0 {
+			objects = append(objects, clusterRole(options, cluster)...)
+		}
+	}
+
+	docs := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to marshal RBAC")
+		}
+		// the objects are printed before being created
+		docs = append(docs, strings.Replace(string(b), "  creationTimestamp: null\n", "", 1))
+	}
+	return secretsWarning(config) + strings.Join(docs, "---\n"), nil
+}
+
+// secretsWarning returns a YAML comment calling out that redacting secrets
+// grants reading all of them, as RBAC can't narrow get down to the secrets the
+// tailed pods use
+func secretsWarning(config *Config) string {
+	if !config.RedactSecrets {
+		return ""
+	}
+	scope := "in namespace " + config.Namespace
+	if config.clusterWide() {
+		scope = "in every namespace"
+	}
+	return "# --redact-secrets grants get on every secret " + scope + ",\n" +
+		"# not only on the secrets of the tailed pods\n"
+}
+
+// clusterRole returns a ClusterRole with rules and its binding
+func clusterRole(options RBACOptions, rules []rbacv1.PolicyRule) []runtime.Object {
+	return []runtime.Object{
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: options.Name},
+			Rules:      rules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: options.Name},
+			Subjects:   options.Subjects,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: options.Name},
+		},
+	}
+}
+
+// RBACSubject parses a subject given as user:NAME, group:NAME or
+// serviceaccount:NAMESPACE:NAME
+func RBACSubject(s string) (rbacv1.Subject, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return rbacv1.Subject{}, errors.Errorf("invalid subject %q, expected user:NAME, group:NAME or serviceaccount:NAMESPACE:NAME", s)
+	}
+	switch parts[0] {
+	case "user":
+		return rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: parts[1]}, nil
+	case "group":
+		return rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: parts[1]}, nil
+	case "serviceaccount":
+		ns := strings.SplitN(parts[1], ":", 2)
+		if len(ns) != 2 || ns[0] == "" || ns[1] == "" {
+			return rbacv1.Subject{}, errors.Errorf("invalid subject %q, expected serviceaccount:NAMESPACE:NAME", s)
+		}
+		return rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: ns[0], Name: ns[1]}, nil
+	default:
+		return rbacv1.Subject{}, errors.Errorf("invalid subject kind %q, expected user, group or serviceaccount", parts[0])
+	}
+}
@@ -0,0 +1,129 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestRBAC(t *testing.T) {
+	user := rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "jane"}
+	tests := []struct {
+		name     string
+		config   *Config
+		estimate bool
+		kinds    []string
+		contains []string
+		excludes []string
+	}{
+		{
+			"namespace",
+			&Config{Namespace: "prod"},
+			false,
+			[]string{"Role", "RoleBinding"},
+			[]string{"namespace: prod", "- pods/log", "- watch"},
+			[]string{"secrets", "jobs", "nodes", "#"},
+		},
+		{
+			"redact and job",
+			&Config{Namespace: "prod", RedactSecrets: true, ResourceQuery: &ResourceQuery{Kind: KindJob, Name: "migrate"}},
+			false,
+			[]string{"Role", "RoleBinding"},
+			[]string{"# --redact-secrets grants get on every secret in namespace prod", "- secrets", "- batch", "- jobs"},
+			[]string{"nodes"},
+		},
+		{
+			"estimate",
+			&Config{Namespace: "prod"},
+			true,
+			[]string{"Role", "RoleBinding", "ClusterRole", "ClusterRoleBinding"},
+			[]string{"- nodes/proxy"},
+			nil,
+		},
+		{
+			"all namespaces",
+			&Config{AllNamespaces: true},
+			false,
+			[]string{"ClusterRole", "ClusterRoleBinding"},
+			[]string{"- pods/log"},
+			[]string{"namespace:", "nodes"},
+		},
+		{
+			"ip",
+			&Config{Namespace: "prod", ResourceQuery: &ResourceQuery{Kind: KindIP, Name: "10.0.0.1"}},
+			false,
+			[]string{"ClusterRole", "ClusterRoleBinding"},
+			[]string{"- nodes\n", "- pods/log"},
+			[]string{"namespace:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := RBAC(tt.config, RBACOptions{Name: "stern", Subjects: []rbacv1.Subject{user}, EstimateVolume: tt.estimate})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var kinds []string
+			for _, line := range strings.Split(out, "\n") {
+				if strings.HasPrefix(line, "kind: ") {
+					kinds = append(kinds, strings.TrimPrefix(line, "kind: "))
+				}
+			}
+			if strings.Join(kinds, ",") != strings.Join(tt.kinds, ",") {
+				t.Errorf("expected kinds %v, got %v", tt.kinds, kinds)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("expected %q in:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(out, s) {
+					t.Errorf("unexpected %q in:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRBACSubject(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected rbacv1.Subject
+		err      bool
+	}{
+		{"user:jane", rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "jane"}, false},
+		{"group:dev", rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "dev"}, false},
+		{"serviceaccount:ci:deployer", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "ci", Name: "deployer"}, false},
+		{"serviceaccount:deployer", rbacv1.Subject{}, true},
+		{"jane", rbacv1.Subject{}, true},
+		{"robot:x", rbacv1.Subject{}, true},
+	}
+
+	for _, tt := range tests {
+		subject, err := RBACSubject(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.s, err)
+		}
+		if subject != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.s, tt.expected, subject)
+		}
+	}
+}
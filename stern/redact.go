@@ -0,0 +1,247 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// redacted replaces secret values in log lines
+	redacted = "[REDACTED]"
+
+	// minSecretLength is the length below which values aren't redacted, as
+	// masking every "true" or "1" would make logs unreadable
+	minSecretLength = 4
+)
+
+// secretRef is a secret referenced by a pod, with the keys it uses or all
+// keys when keys is empty
+type secretRef struct {
+	name string
+	keys []string
+}
+
+// secretRefs returns the secrets referenced by a pod through environment
+// variables and volumes
+func secretRefs(pod *corev1.Pod) []secretRef {
+	refs := make(map[string]map[string]bool)
+	add := func(name, key string) {
+		if refs[name] == nil {
+			refs[name] = make(map[string]bool)
+		}
+		refs[name][key] = true
+	}
+
+	var containers []corev1.Container
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				add(env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key)
+			}
+		}
+		for _, envFrom := range c.EnvFrom {
+			if envFrom.SecretRef != nil {
+				add(envFrom.SecretRef.Name, "")
+			}
+		}
+	}
+
+	addSecretProjection := func(name string, items []corev1.KeyToPath) {
+		if len(items) == 0 {
+			add(name, "")
+		}
+		for _, item := range items {
+			add(name, item.Key)
+		}
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.Secret != nil {
+			addSecretProjection(v.Secret.SecretName, v.Secret.Items)
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.Secret != nil {
+					addSecretProjection(source.Secret.Name, source.Secret.Items)
+				}
+			}
+		}
+	}
+
+	var result []secretRef
+	for name, keys := range refs {
+		ref := secretRef{name: name}
+		if !keys[""] {
+			for key := range keys {
+				ref.keys = append(ref.keys, key)
+			}
+			sort.Strings(ref.keys)
+		}
+		result = append(result, ref)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// newRedactor returns a replacer masking the values, their lines and their
+// base64 forms. It returns nil when there is nothing to mask.
+func newRedactor(values [][]byte) *strings.Replacer {
+	patterns := make(map[string]bool)
+	add := func(s string) {
+		if len(s) >= minSecretLength {
+			patterns[s] = true
+		}
+	}
+
+	for _, v := range values {
+		s := strings.TrimSpace(string(v))
+		add(s)
+		add(base64.StdEncoding.EncodeToString([]byte(s)))
+		add(base64.RawStdEncoding.EncodeToString([]byte(s)))
+		if strings.Contains(s, "\n") {
+			// multi-line values such as keys are logged line by line
+			for _, line := range strings.Split(s, "\n") {
+				add(strings.TrimSpace(line))
+			}
+		}
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	// longer patterns first, so a value doesn't hide a longer one containing it
+	var sorted []string
+	for p := range patterns {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	var oldnew []string
+	for _, p := range sorted {
+		oldnew = append(oldnew, p, redacted)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// redactors builds and caches the redactor of every pod
+type redactors struct {
+	clientset k8s.Interface
+
+	mu    sync.Mutex
+	cache map[string]*redactorEntry
+}
+
+// redactorEntry is the redactor of a pod, which is ready once done is closed
+type redactorEntry struct {
+	done     chan struct{}
+	redactor *strings.Replacer
+	err      error
+}
+
+// newRedactors returns the redactors for config, which are nil unless secrets
+// should be redacted
+func newRedactors(clientset k8s.Interface, config *Config) *redactors {
+	if !config.RedactSecrets {
+		return nil
+	}
+	return &redactors{
+		clientset: clientset,
+		cache:     make(map[string]*redactorEntry),
+	}
+}
+
+// forTarget returns the redactor for the pod of a target, or nil when r is
+// nil. It fails when the pod or one of its secrets can't be read, as tailing
+// the target would leak them. Failures aren't cached so a retry looks the
+// secrets up again.
+func (r *redactors) forTarget(t *Target) (*strings.Replacer, error) {
+	if r == nil {
+		return nil, nil
+	}
+	key := t.Namespace + "/" + t.Pod
+
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	if !ok {
+		entry = &redactorEntry{done: make(chan struct{})}
+		r.cache[key] = entry
+	}
+	r.mu.Unlock()
+
+	if ok {
+		<-entry.done
+		return entry.redactor, entry.err
+	}
+
+	entry.redactor, entry.err = r.resolve(t)
+	if entry.err != nil {
+		r.mu.Lock()
+		delete(r.cache, key)
+		r.mu.Unlock()
+	}
+	close(entry.done)
+	return entry.redactor, entry.err
+}
+
+// resolve reads the secrets used by the pod of a target and builds its
+// redactor
+func (r *redactors) resolve(t *Target) (*strings.Replacer, error) {
+	pod, err := r.clientset.CoreV1().Pods(t.Namespace).Get(t.Pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to redact secrets of %s/%s", t.Namespace, t.Pod)
+	}
+
+	var values [][]byte
+	for _, ref := range secretRefs(pod) {
+		secret, err := r.clientset.CoreV1().Secrets(t.Namespace).Get(ref.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// an optional secret which doesn't exist has nothing to leak
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to redact secret %s/%s used by %s", t.Namespace, ref.name, t.Pod)
+		}
+		if len(ref.keys) == 0 {
+			for _, v := range secret.Data {
+				values = append(values, v)
+			}
+			continue
+		}
+		for _, key := range ref.keys {
+			if v, ok := secret.Data[key]; ok {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return newRedactor(values), nil
+}
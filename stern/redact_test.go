@@ -0,0 +1,125 @@
+package stern
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestRedactors(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-1"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				Env: []corev1.EnvVar{{
+					Name: "DB_PASSWORD",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "db"},
+							Key:                  "password",
+						},
+					},
+				}},
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "api"}},
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name:         "tls",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}},
+			}},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(
+		pod,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+			Data: map[string][]byte{
+				"password": []byte("hunter22"),
+				"username": []byte("admin-user"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api"},
+			Data:       map[string][]byte{"API_TOKEN": []byte("tok-123456")},
+		},
+	)
+
+	refs := secretRefs(pod)
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 secret references, got %v", refs)
+	}
+	if refs[1].name != "db" || len(refs[1].keys) != 1 || refs[1].keys[0] != "password" {
+		t.Errorf("expected only the password key of db to be referenced, got %v", refs[1])
+	}
+
+	r := newRedactors(clientset, &Config{RedactSecrets: true})
+	redactor, err := r.forTarget(&Target{Namespace: "shop", Pod: "api-1", Container: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redactor == nil {
+		t.Fatal("expected a redactor")
+	}
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"connecting with password hunter22\n", "connecting with password [REDACTED]\n"},
+		{"Authorization: Basic aHVudGVyMjI=\n", "Authorization: Basic [REDACTED]\n"},
+		{"token=tok-123456\n", "token=[REDACTED]\n"},
+		{"user admin-user logged in\n", "user admin-user logged in\n"},
+	}
+	for _, tt := range tests {
+		if actual := redactor.Replace(tt.line); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	if redactor, _ := newRedactors(clientset, &Config{}).forTarget(&Target{Namespace: "shop", Pod: "api-1"}); redactor != nil {
+		t.Errorf("expected no redactor when secrets aren't redacted")
+	}
+}
+
+func TestRunRedactFailsClosed(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-1"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "nginx",
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web"}},
+				}},
+			}},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	clientset.PrependReactor("get", "secrets", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "web", fmt.Errorf("no"))
+	})
+
+	config := newSourceConfig()
+	config.RedactSecrets = true
+	until := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(until) })
+	var out syncBuffer
+	if err := run(context.Background(), newMemorySource(), newRedactors(clientset, config), config, &out, until); err != nil {
+		t.Fatal(err)
+	}
+
+	if output := out.buf.String(); strings.Contains(output, "GET /api 500") || strings.Contains(output, "proxy ready") {
+		t.Errorf("expected no logs of a pod whose secrets can't be read, got %q", output)
+	}
+}
@@ -0,0 +1,293 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ResourceQuery selects the pods to tail through something else than a
+// regular expression on their names, like ip/10.2.3.4
+type ResourceQuery struct {
+	Kind string
+	Name string
+}
+
+const (
+	// KindIP selects the pods holding an IP, or the pods behind an
+	// in-cluster DNS name
+	KindIP = "ip"
+
+	// KindJob selects the pods of a Job, including those of its retries
+	KindJob = "job"
+)
+
+var resourceQueryKinds = []string{KindIP, KindJob}
+
+// secondaryIPPageSize is the number of pods listed at once when looking for a
+// secondary IP
+const secondaryIPPageSize = 500
+
+// ParseResourceQuery returns the resource query in query, or nil when query
+// is a regular expression
+func ParseResourceQuery(query string) *ResourceQuery {
+	for _, kind := range resourceQueryKinds {
+		if strings.HasPrefix(query, kind+"/") && len(query) > len(kind)+1 {
+			return &ResourceQuery{Kind: kind, Name: query[len(kind)+1:]}
+		}
+	}
+	return nil
+}
+
+func (q *ResourceQuery) String() string {
+	return q.Kind + "/" + q.Name
+}
+
+// podRef is a pod a resource query resolved to
+type podRef struct {
+	namespace string
+	name      string
+}
+
+// resolve narrows a config with a resource query down to the pods it refers
+// to. It returns the config and namespace to use from then on.
+func resolve(clientset k8s.Interface, namespace string, config *Config) (*Config, string, error) {
+	if config.ResourceQuery == nil {
+		return config, namespace, nil
+	}
+
+	if config.ResourceQuery.Kind == KindJob {
+		return resolveJob(clientset, namespace, config)
+	}
+
+	var pods []podRef
+	var err error
+	switch config.ResourceQuery.Kind {
+	case KindIP:
+		pods, err = resolveIP(clientset, config.ResourceQuery.Name)
+	default:
+		err = fmt.Errorf("unknown resource query kind %q", config.ResourceQuery.Kind)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pods) == 0 {
+		return nil, "", fmt.Errorf("no pods found for %s", config.ResourceQuery)
+	}
+
+	namespaces := make(map[string]bool)
+	var names []string
+	for _, p := range pods {
+		namespaces[p.namespace] = true
+		names = append(names, regexp.QuoteMeta(p.name))
+	}
+	sort.Strings(names)
+
+	resolved := *config
+	resolved.PodQuery = regexp.MustCompile("^(" + strings.Join(names, "|") + ")$")
+	if len(namespaces) == 1 {
+		resolved.AllNamespaces = false
+		namespace = pods[0].namespace
+	} else {
+		resolved.AllNamespaces = true
+		namespace = ""
+	}
+	return &resolved, namespace, nil
+}
+
+// resolveIP returns the pods holding an IP. For the IP of a node it returns
+// the pods running on it with the host network. name can also be an
+// in-cluster DNS name.
+func resolveIP(clientset k8s.Interface, name string) ([]podRef, error) {
+	ip := net.ParseIP(name)
+	if ip == nil {
+		return resolveHostname(clientset, name)
+	}
+	addr := ip.String()
+
+	pods, err := clientset.CoreV1().Pods("").List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.podIP", addr).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods by IP")
+	}
+	var refs []podRef
+	for _, p := range pods.Items {
+		if p.Status.PodIP == addr && isAlive(&p) {
+			refs = append(refs, podRef{namespace: p.Namespace, name: p.Name})
+		}
+	}
+	if len(refs) > 0 {
+		return refs, nil
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	for _, node := range nodes.Items {
+		for _, a := range node.Status.Addresses {
+			if a.Address != addr {
+				continue
+			}
+			pods, err := clientset.CoreV1().Pods("").List(metav1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to list pods of node")
+			}
+			for _, p := range pods.Items {
+				if p.Spec.NodeName == node.Name && p.Spec.HostNetwork && isAlive(&p) {
+					refs = append(refs, podRef{namespace: p.Namespace, name: p.Name})
+				}
+			}
+			if len(refs) == 0 {
+				return nil, fmt.Errorf("%s is the IP of node %s, which runs no pods with the host network", addr, node.Name)
+			}
+			return refs, nil
+		}
+	}
+
+	// the secondary IPs of dual-stack pods are only in status.podIPs
+	return podsWithSecondaryIP(clientset, addr)
+}
+
+// listPodsRaw lists the pods of all namespaces as JSON. The typed client
+// doesn't know status.podIPs, so the list is decoded directly.
+var listPodsRaw = func(clientset k8s.Interface, opts metav1.ListOptions) ([]byte, error) {
+	return clientset.CoreV1().RESTClient().Get().
+		Resource("pods").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Raw()
+}
+
+// podsWithSecondaryIP returns the live pod which has ip in status.podIPs.
+// The field can't be selected on, so the pods which haven't finished are
+// listed page by page until one has it, as no two live pods share an IP.
+func podsWithSecondaryIP(clientset k8s.Interface, ip string) ([]podRef, error) {
+	opts := metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+		).String(),
+		Limit: secondaryIPPageSize,
+	}
+
+	for {
+		raw, err := listPodsRaw(clientset, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list pods")
+		}
+
+		var list struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []struct {
+				Metadata struct {
+					Namespace string `json:"namespace"`
+					Name      string `json:"name"`
+				} `json:"metadata"`
+				Status struct {
+					Phase  corev1.PodPhase `json:"phase"`
+					PodIPs []struct {
+						IP string `json:"ip"`
+					} `json:"podIPs"`
+				} `json:"status"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, errors.Wrap(err, "failed to decode pods")
+		}
+
+		for _, p := range list.Items {
+			if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			for _, podIP := range p.Status.PodIPs {
+				if parsed := net.ParseIP(podIP.IP); parsed != nil && parsed.String() == ip {
+					return []podRef{{namespace: p.Metadata.Namespace, name: p.Metadata.Name}}, nil
+				}
+			}
+		}
+
+		if list.Metadata.Continue == "" {
+			return nil, nil
+		}
+		opts.Continue = list.Metadata.Continue
+	}
+}
+
+// resolveHostname returns the pods behind an in-cluster DNS name, either
+// hostname.subdomain.namespace.svc.<domain> for pods of a headless service or
+// a-b-c-d.namespace.pod.<domain>. Other names are looked up in DNS.
+func resolveHostname(clientset k8s.Interface, host string) ([]podRef, error) {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+
+	if len(labels) >= 4 && labels[3] == "svc" {
+		hostname, subdomain, namespace := labels[0], labels[1], labels[2]
+		pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list pods")
+		}
+		var refs []podRef
+		for _, p := range pods.Items {
+			if p.Spec.Hostname == hostname && p.Spec.Subdomain == subdomain && isAlive(&p) {
+				refs = append(refs, podRef{namespace: p.Namespace, name: p.Name})
+			}
+		}
+		return refs, nil
+	}
+
+	if len(labels) >= 3 && labels[2] == "pod" {
+		for _, candidate := range []string{strings.Replace(labels[0], "-", ".", -1), strings.Replace(labels[0], "-", ":", -1)} {
+			if net.ParseIP(candidate) != nil {
+				return resolveIP(clientset, candidate)
+			}
+		}
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve %s", host)
+	}
+	var refs []podRef
+	for _, ip := range ips {
+		r, err := resolveIP(clientset, ip.String())
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r...)
+	}
+	return refs, nil
+}
+
+// isAlive returns false for pods which are done and whose IP may be reused
+func isAlive(pod *corev1.Pod) bool {
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
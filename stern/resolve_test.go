@@ -0,0 +1,116 @@
+package stern
+
+import (
+	"regexp"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseResourceQuery(t *testing.T) {
+	if q := ParseResourceQuery("ip/10.2.3.4"); q == nil || q.Kind != KindIP || q.Name != "10.2.3.4" {
+		t.Errorf("expected ip query, got %v", q)
+	}
+	for _, query := range []string{"web-\\w", "ip/", "ipsec-gateway"} {
+		if q := ParseResourceQuery(query); q != nil {
+			t.Errorf("expected %q to be a regular expression, got %v", query, q)
+		}
+	}
+}
+
+func TestResolveIP(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-0"},
+			Spec:       corev1.PodSpec{Hostname: "web-0", Subdomain: "web", NodeName: "node-1"},
+			Status:     corev1.PodStatus{PodIP: "10.2.3.4", Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "old-web"},
+			Status:     corev1.PodStatus{PodIP: "10.2.3.4", Phase: corev1.PodSucceeded},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-proxy-abc"},
+			Spec:       corev1.PodSpec{HostNetwork: true, NodeName: "node-1"},
+			Status:     corev1.PodStatus{PodIP: "192.168.0.10", Phase: corev1.PodRunning},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.168.0.10"},
+				{Type: corev1.NodeExternalIP, Address: "35.1.2.3"},
+			}},
+		},
+	)
+
+	tests := []struct {
+		query     string
+		namespace string
+		pods      string
+	}{
+		{"10.2.3.4", "shop", "^(web-0)$"},
+		{"192.168.0.10", "kube-system", "^(kube-proxy-abc)$"},
+		{"35.1.2.3", "kube-system", "^(kube-proxy-abc)$"},
+		{"web-0.web.shop.svc.cluster.local", "shop", "^(web-0)$"},
+		{"10-2-3-4.shop.pod.cluster.local", "shop", "^(web-0)$"},
+	}
+
+	for _, tt := range tests {
+		config := &Config{
+			PodQuery:      regexp.MustCompile(".*"),
+			ResourceQuery: &ResourceQuery{Kind: KindIP, Name: tt.query},
+		}
+		resolved, namespace, err := resolve(clientset, "default", config)
+		if err != nil {
+			t.Errorf("%s: %s", tt.query, err)
+			continue
+		}
+		if namespace != tt.namespace {
+			t.Errorf("%s: expected namespace %s, got %s", tt.query, tt.namespace, namespace)
+		}
+		if resolved.PodQuery.String() != tt.pods {
+			t.Errorf("%s: expected pod query %s, got %s", tt.query, tt.pods, resolved.PodQuery)
+		}
+	}
+}
+
+func TestResolveSecondaryIP(t *testing.T) {
+	pages := map[string]string{
+		"": `{"metadata": {"continue": "page-2"}, "items": [
+			{"metadata": {"namespace": "shop", "name": "web-0"}, "status": {"phase": "Running", "podIPs": [{"ip": "10.2.3.4"}, {"ip": "fd00::4"}]}}
+		]}`,
+		"page-2": `{"metadata": {}, "items": [
+			{"metadata": {"namespace": "shop", "name": "old-web"}, "status": {"phase": "Failed", "podIPs": [{"ip": "10.2.3.5"}, {"ip": "fd00::5"}]}},
+			{"metadata": {"namespace": "shop", "name": "web-1"}, "status": {"phase": "Running", "podIPs": [{"ip": "10.2.3.5"}, {"ip": "fd00:0::5"}]}}
+		]}`,
+	}
+	var selectors []string
+	defer func(original func(k8s.Interface, metav1.ListOptions) ([]byte, error)) { listPodsRaw = original }(listPodsRaw)
+	listPodsRaw = func(_ k8s.Interface, opts metav1.ListOptions) ([]byte, error) {
+		selectors = append(selectors, opts.FieldSelector)
+		return []byte(pages[opts.Continue]), nil
+	}
+
+	config := &Config{
+		PodQuery:      regexp.MustCompile(".*"),
+		ResourceQuery: &ResourceQuery{Kind: KindIP, Name: "fd00::5"},
+	}
+	resolved, namespace, err := resolve(fake.NewSimpleClientset(), "default", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "shop" || resolved.PodQuery.String() != "^(web-1)$" {
+		t.Errorf("expected web-1 in shop, got %s in %s", resolved.PodQuery, namespace)
+	}
+	if len(selectors) != 2 || selectors[0] != "status.phase!=Succeeded,status.phase!=Failed" {
+		t.Errorf("expected two pages of the pods which haven't finished, got %q", selectors)
+	}
+
+	config.ResourceQuery.Name = "fd00::9"
+	if _, _, err := resolve(fake.NewSimpleClientset(), "default", config); err == nil {
+		t.Errorf("expected an error for an IP no pod holds")
+	}
+}
@@ -0,0 +1,86 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Backoff is an exponential backoff with jitter used between attempts to open
+// the log stream of a target
+type Backoff struct {
+	// Initial is the delay before the first retry
+	Initial time.Duration
+
+	// Max caps the delay between two retries
+	Max time.Duration
+
+	// MaxRetries is the retry budget of a target, a negative value meaning
+	// unlimited retries
+	MaxRetries int
+}
+
+// Delay returns the delay before the given attempt, starting at 1. The delay
+// doubles on every attempt and is randomized between half and all of it.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial) * math.Pow(2, float64(attempt-1))
+	if d > float64(b.Max) || math.IsInf(d, 1) {
+		d = float64(b.Max)
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// Exhausted returns true when no attempts are left after the given attempt
+func (b Backoff) Exhausted(attempt int) bool {
+	return b.MaxRetries >= 0 && attempt > b.MaxRetries
+}
+
+// isPermanentError returns true for errors which retrying won't fix, such as
+// missing permissions or a container which doesn't exist
+func isPermanentError(err error) bool {
+	err = errors.Cause(err)
+	if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) || apierrors.IsNotFound(err) {
+		return true
+	}
+	if apierrors.IsBadRequest(err) {
+		msg := err.Error()
+		return strings.Contains(msg, "not found") || strings.Contains(msg, "is not valid for pod")
+	}
+	return false
+}
+
+// retryState tracks the failed attempts of a target
+type retryState struct {
+	attempts int
+	timer    *time.Timer
+
+	// pending is true while waiting for the next attempt
+	pending bool
+
+	// gaveUp is true when the error is permanent or the budget is exhausted
+	gaveUp bool
+}
+
+func (r *retryState) stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
@@ -0,0 +1,152 @@
+package stern
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second, MaxRetries: 3}
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			d := b.Delay(tt.attempt)
+			if d < tt.expected/2 || d > tt.expected {
+				t.Errorf("attempt %d: expected delay between %s and %s, got %s", tt.attempt, tt.expected/2, tt.expected, d)
+			}
+		}
+	}
+
+	if b.Exhausted(3) {
+		t.Errorf("expected attempt 3 to be within the budget")
+	}
+	if !b.Exhausted(4) {
+		t.Errorf("expected attempt 4 to exhaust the budget")
+	}
+	if (Backoff{MaxRetries: -1}).Exhausted(1000) {
+		t.Errorf("expected negative budget to be unlimited")
+	}
+}
+
+func TestIsPermanentError(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{apierrors.NewForbidden(pods, "web", fmt.Errorf("no")), true},
+		{apierrors.NewNotFound(pods, "web"), true},
+		{apierrors.NewBadRequest(`container "sidecar" in pod "web" is waiting to start: ContainerCreating`), false},
+		{apierrors.NewBadRequest("container sidecar is not valid for pod web"), true},
+		{apierrors.NewInternalError(fmt.Errorf("boom")), false},
+		{errors.Wrap(apierrors.NewForbidden(pods, "web", fmt.Errorf("no")), "error opening stream"), true},
+		{fmt.Errorf("connection refused"), false},
+	}
+
+	for i, tt := range tests {
+		if actual := isPermanentError(tt.err); actual != tt.expected {
+			t.Errorf("%d: expected %v for %q, got %v", i, tt.expected, tt.err, actual)
+		}
+	}
+}
+
+// flakySource fails to open the streams of a memorySource a number of times
+// and adds its targets again after readd
+type flakySource struct {
+	*memorySource
+	readd time.Duration
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakySource) Watch(ctx context.Context, filter *TargetFilter) (<-chan *Target, <-chan *Target, error) {
+	added := make(chan *Target)
+	go func() {
+		for i := 0; i < 2; i++ {
+			for _, t := range s.matching(filter) {
+				select {
+				case added <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if s.readd == 0 {
+				return
+			}
+			time.Sleep(s.readd)
+		}
+	}()
+	return added, make(chan *Target), nil
+}
+
+func (s *flakySource) Stream(ctx context.Context, target *Target, opts *StreamOptions) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("connection reset by peer")
+	}
+	return s.memorySource.Stream(ctx, target, opts)
+}
+
+func TestRunRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   int
+		readd      time.Duration
+		markers    int
+	}{
+		// retries continue the tail announced first
+		{"retried", 5, 2, 0, 1},
+		// the tail is announced again after giving up
+		{"added again after giving up", 0, 1, 50 * time.Millisecond, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newSourceConfig()
+			config.ContainerQuery = regexp.MustCompile("nginx")
+			config.Backoff = Backoff{Initial: time.Millisecond, Max: time.Millisecond, MaxRetries: tt.maxRetries}
+			source := &flakySource{memorySource: newMemorySource(), failures: tt.failures, readd: tt.readd}
+
+			until := make(chan struct{})
+			time.AfterFunc(200*time.Millisecond, func() { close(until) })
+			var out syncBuffer
+			if err := run(context.Background(), source, nil, config, &out, until); err != nil {
+				t.Fatal(err)
+			}
+
+			output := out.buf.String()
+			if n := strings.Count(output, "+ "); n != tt.markers {
+				t.Errorf("expected %d added markers, got %d in %q", tt.markers, n, output)
+			}
+			if !strings.Contains(output, "GET /api 500") {
+				t.Errorf("expected the logs, got %q", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The ways of tailing known sidecars
+const (
+	// SidecarsShow tails sidecars like any other container
+	SidecarsShow = "show"
+
+	// SidecarsQuiet only shows the warnings and errors of sidecars, and the
+	// access log lines with a 5xx status
+	SidecarsQuiet = "quiet"
+
+	// SidecarsHide excludes sidecars by container name. Sidecars which are
+	// only recognised by their image are quieted instead.
+	SidecarsHide = "hide"
+)
+
+// SidecarModes are the valid ways of tailing known sidecars
+var SidecarModes = []string{SidecarsShow, SidecarsQuiet, SidecarsHide}
+
+// SidecarProfile recognises a common sidecar or agent and the lines worth
+// keeping when it's quieted
+type SidecarProfile struct {
+	Name string
+
+	// Container and Image match the container name and image of the sidecar.
+	// Image is nil when the image also runs as the main container of pods,
+	// like the Vault server.
+	Container *regexp.Regexp
+	Image     *regexp.Regexp
+
+	// Important matches the lines at warning level or above
+	Important *regexp.Regexp
+
+	// AccessLog matches access log lines, capturing their status code in
+	// the group named status. It is nil when the sidecar logs no requests.
+	AccessLog *regexp.Regexp
+}
+
+// commonLogRequest matches the request and status of an access log line in
+// the common log format
+const commonLogRequest = `"[A-Z]+ [^"]* HTTP/[0-9.]+" (?P<status>\d{3})\b`
+
+// SidecarProfiles are the known sidecars
+var SidecarProfiles = []*SidecarProfile{
+	{
+		Name:      "istio-proxy",
+		Container: regexp.MustCompile(`^istio-proxy$`),
+		Image:     regexp.MustCompile(`(^|/)proxyv2([:@]|$)`),
+		Important: regexp.MustCompile(`\t(warn|warning|error|critical)\t|\[(warning|error|critical)\]`),
+		AccessLog: regexp.MustCompile(`^\[[^\]]+\] ` + commonLogRequest),
+	},
+	{
+		Name:      "linkerd-proxy",
+		Container: regexp.MustCompile(`^linkerd-proxy$`),
+		Image:     regexp.MustCompile(`(^|/)(linkerd/proxy|linkerd-io/proxy)([:@]|$)`),
+		Important: regexp.MustCompile(`\b(WARN|ERROR)\b`),
+		AccessLog: regexp.MustCompile(commonLogRequest),
+	},
+	{
+		Name:      "vault-agent",
+		Container: regexp.MustCompile(`^vault-agent(-init)?$`),
+		Important: regexp.MustCompile(`\[(WARN|ERROR)\]`),
+	},
+	{
+		Name:      "fluent-bit",
+		Container: regexp.MustCompile(`^fluent-?bit$`),
+		Important: regexp.MustCompile(`\[\s*(warn|error)\]`),
+	},
+	{
+		Name:      "cloud-sql-proxy",
+		Container: regexp.MustCompile(`^cloud-?sql-proxy$`),
+		Image:     regexp.MustCompile(`(^|/)(cloud-?sql-proxy|gce-proxy)([:@]|$)`),
+		Important: regexp.MustCompile(`(?i)\b(error|failed|couldn't|refused|timeout)\b`),
+	},
+}
+
+// SidecarFor returns the profile of a container, or nil when it's not a known
+// sidecar
+func SidecarFor(container, image string) *SidecarProfile {
+	for _, p := range SidecarProfiles {
+		if p.Container.MatchString(container) || (image != "" && p.Image != nil && p.Image.MatchString(image)) {
+			return p
+		}
+	}
+	return nil
+}
+
+// ExcludeSidecars layers the container names of the known sidecars onto the
+// exclude container query, which may be nil
+func ExcludeSidecars(exclude *regexp.Regexp) *regexp.Regexp {
+	var queries []string
+	if exclude != nil {
+		queries = append(queries, "(?:"+exclude.String()+")")
+	}
+	for _, p := range SidecarProfiles {
+		queries = append(queries, "(?:"+p.Container.String()+")")
+	}
+	return regexp.MustCompile(strings.Join(queries, "|"))
+}
+
+// keep returns true for the lines of the sidecar shown when it's quieted. The
+// timestamp requested with --timestamps is ignored.
+func (p *SidecarProfile) keep(line string) bool {
+	_, line = splitTimestamp(line)
+	if p.Important.MatchString(line) {
+		return true
+	}
+	if p.AccessLog == nil {
+		return false
+	}
+	m := p.AccessLog.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	for i, name := range p.AccessLog.SubexpNames() {
+		if name == "status" {
+			return strings.HasPrefix(m[i], "5")
+		}
+	}
+	return false
+}
+
+// sidecarFor returns the profile applying to the lines of a target, which is
+// nil unless sidecars are quieted
+func (c *Config) sidecarFor(t *Target) *SidecarProfile {
+	if c.Sidecars != SidecarsQuiet && c.Sidecars != SidecarsHide {
+		return nil
+	}
+	return SidecarFor(t.Container, t.Image)
+}
@@ -0,0 +1,121 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSidecarFor(t *testing.T) {
+	tests := []struct {
+		container string
+		image     string
+		expected  string
+	}{
+		{"istio-proxy", "docker.io/istio/proxyv2:1.2.0", "istio-proxy"},
+		{"envoy", "docker.io/istio/proxyv2:1.2.0", "istio-proxy"},
+		{"linkerd-proxy", "", "linkerd-proxy"},
+		{"vault-agent-init", "vault:1.1.3", "vault-agent"},
+		{"fluent-bit", "fluent/fluent-bit:1.1", "fluent-bit"},
+		// the main containers of Vault servers and fluent-bit DaemonSets
+		{"vault", "hashicorp/vault:1.1.3", ""},
+		{"logs", "fluent/fluent-bit:1.1", ""},
+		{"cloudsql-proxy", "gcr.io/cloudsql-docker/gce-proxy:1.14", "cloud-sql-proxy"},
+		{"app", "example.com/app:1.0", ""},
+		{"proxy", "nginx", ""},
+	}
+
+	for _, tt := range tests {
+		p := SidecarFor(tt.container, tt.image)
+		name := ""
+		if p != nil {
+			name = p.Name
+		}
+		if name != tt.expected {
+			t.Errorf("%s (%s): expected %q, got %q", tt.container, tt.image, tt.expected, name)
+		}
+	}
+}
+
+func TestSidecarKeep(t *testing.T) {
+	tests := []struct {
+		sidecar  string
+		line     string
+		expected bool
+	}{
+		{"istio-proxy", "2019-06-20T10:00:00.000000Z\twarn\tEnvoy proxy is NOT ready", true},
+		{"istio-proxy", "2019-06-20T10:00:00.000000Z\tinfo\tEnvoy proxy is ready", false},
+		{"istio-proxy", `[2019-06-20T10:00:00.000Z] "GET /api HTTP/1.1" 200 - "-" 0 12 3 2 "-"`, false},
+		{"istio-proxy", `[2019-06-20T10:00:00.000Z] "GET /api HTTP/1.1" 503 UH "-" 0 91 0 - "-"`, true},
+		{"linkerd-proxy", "[     0.002s]  WARN ThreadId(01) outbound: connection refused", true},
+		{"linkerd-proxy", "[     0.002s]  INFO ThreadId(01) linkerd2_proxy: Admin interface on 0.0.0.0:4191", false},
+		{"vault-agent", "2019-06-20T10:00:00.000Z [ERROR] auth.handler: error authenticating", true},
+		{"vault-agent", "2019-06-20T10:00:00.000Z [INFO]  sink.file: token written", false},
+		{"fluent-bit", "[2019/06/20 10:00:00] [ warn] [engine] failed to flush chunk", true},
+		{"fluent-bit", "[2019/06/20 10:00:00] [ info] [engine] started", false},
+		{"cloud-sql-proxy", `2019/06/20 10:00:00 couldn't connect to "proj:region:db": dial tcp: i/o timeout`, true},
+		{"cloud-sql-proxy", `2019/06/20 10:00:00 New connection for "proj:region:db"`, false},
+	}
+
+	for i, tt := range tests {
+		p := SidecarFor(tt.sidecar, "")
+		if p == nil {
+			t.Fatalf("%d: unknown sidecar %s", i, tt.sidecar)
+		}
+		if actual := p.keep(tt.line); actual != tt.expected {
+			t.Errorf("%d: expected %t for %q, got %t", i, tt.expected, tt.line, actual)
+		}
+	}
+}
+
+func TestSidecarKeepTimestamps(t *testing.T) {
+	options := &TailOptions{Timestamps: true, Sidecar: SidecarFor("istio-proxy", "")}
+	ts := "2019-06-20T10:00:00.123456789Z "
+	if !options.matches(ts + `[2019-06-20T10:00:00.000Z] "GET /api HTTP/1.1" 503 UH "-" 0 91 0 - "-"` + "\n") {
+		t.Errorf("expected a 5xx access log line with a timestamp to be kept")
+	}
+	if options.matches(ts + `[2019-06-20T10:00:00.000Z] "GET /api HTTP/1.1" 200 - "-" 0 12 3 2 "-"` + "\n") {
+		t.Errorf("expected a 2xx access log line with a timestamp to be dropped")
+	}
+}
+
+func TestExcludeSidecars(t *testing.T) {
+	exclude := ExcludeSidecars(regexp.MustCompile("^debug$"))
+	for _, name := range []string{"debug", "istio-proxy", "vault-agent-init", "fluentbit"} {
+		if !exclude.MatchString(name) {
+			t.Errorf("expected %s to be excluded", name)
+		}
+	}
+	for _, name := range []string{"app", "istio-proxy-config", "debugger"} {
+		if exclude.MatchString(name) {
+			t.Errorf("expected %s not to be excluded", name)
+		}
+	}
+
+	if !ExcludeSidecars(nil).MatchString("linkerd-proxy") {
+		t.Errorf("expected linkerd-proxy to be excluded without exclude container query")
+	}
+}
+
+func TestConfigSidecarFor(t *testing.T) {
+	target := &Target{Container: "istio-proxy"}
+	for mode, quieted := range map[string]bool{SidecarsShow: false, SidecarsQuiet: true, SidecarsHide: true} {
+		config := &Config{Sidecars: mode}
+		if (config.sidecarFor(target) != nil) != quieted {
+			t.Errorf("%s: expected quieted to be %t", mode, quieted)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8s "k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Source discovers the targets to tail and streams their logs. Filters,
+// templates, colors and outputs work the same over any source; Kubernetes is
+// the default one.
+type Source interface {
+	// Watch emits the targets matching filter when they're added and
+	// removed, until ctx is done
+	Watch(ctx context.Context, filter *TargetFilter) (added, removed <-chan *Target, err error)
+
+	// List returns the targets currently matching filter
+	List(ctx context.Context, filter *TargetFilter) ([]*Target, error)
+
+	// Stream opens the log stream of a target. With opts.Timestamps, every
+	// line starts with its RFC 3339 timestamp and a space.
+	Stream(ctx context.Context, target *Target, opts *StreamOptions) (io.ReadCloser, error)
+}
+
+// TargetFilter selects the targets of a source
+type TargetFilter struct {
+	PodQuery              *regexp.Regexp
+	ContainerQuery        *regexp.Regexp
+	ExcludeContainerQuery *regexp.Regexp
+	InitContainers        bool
+	ContainerState        ContainerState
+	LabelSelector         labels.Selector
+}
+
+// StreamOptions select the lines of a log stream
+type StreamOptions struct {
+	Follow     bool
+	Timestamps bool
+
+	// SinceSeconds and SinceTime skip older lines, SinceTime taking
+	// precedence when both are set
+	SinceSeconds *int64
+	SinceTime    *time.Time
+
+	TailLines  *int64
+	LimitBytes *int64
+}
+
+// targetFilter returns the filter of the targets of the config
+func (c *Config) targetFilter() *TargetFilter {
+	return &TargetFilter{
+		PodQuery:              c.PodQuery,
+		ContainerQuery:        c.ContainerQuery,
+		ExcludeContainerQuery: c.ExcludeContainerQuery,
+		InitContainers:        c.InitContainers,
+		ContainerState:        c.ContainerState,
+		LabelSelector:         c.LabelSelector,
+	}
+}
+
+// kubernetesSource is the source of the containers of the pods of a namespace
+type kubernetesSource struct {
+	namespace string
+	pods      func(namespace string) v1.PodInterface
+}
+
+// NewKubernetesSource returns the source of the containers of the pods of
+// namespace, or of all namespaces when it's empty
+func NewKubernetesSource(clientset k8s.Interface, namespace string) Source {
+	return &kubernetesSource{
+		namespace: namespace,
+		pods:      clientset.CoreV1().Pods,
+	}
+}
+
+func (s *kubernetesSource) Watch(ctx context.Context, filter *TargetFilter) (<-chan *Target, <-chan *Target, error) {
+	return Watch(ctx, s.pods(s.namespace),
+		filter.PodQuery,
+		filter.ContainerQuery,
+		filter.ExcludeContainerQuery,
+		filter.InitContainers,
+		filter.ContainerState,
+		filter.LabelSelector)
+}
+
+func (s *kubernetesSource) List(ctx context.Context, filter *TargetFilter) ([]*Target, error) {
+	return List(s.pods(s.namespace),
+		filter.PodQuery,
+		filter.ContainerQuery,
+		filter.ExcludeContainerQuery,
+		filter.InitContainers,
+		filter.ContainerState,
+		filter.LabelSelector)
+}
+
+func (s *kubernetesSource) Stream(ctx context.Context, target *Target, opts *StreamOptions) (io.ReadCloser, error) {
+	logOpts := &corev1.PodLogOptions{
+		Container:    target.Container,
+		Follow:       opts.Follow,
+		Timestamps:   opts.Timestamps,
+		SinceSeconds: opts.SinceSeconds,
+		TailLines:    opts.TailLines,
+		LimitBytes:   opts.LimitBytes,
+	}
+	if opts.SinceTime != nil {
+		logOpts.SinceSeconds = nil
+		logOpts.SinceTime = &metav1.Time{Time: *opts.SinceTime}
+	}
+	return s.pods(target.Namespace).GetLogs(target.Pod, logOpts).Context(ctx).Stream()
+}
@@ -0,0 +1,298 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// memoryLine is a line of a memorySource
+type memoryLine struct {
+	time time.Time
+	msg  string
+}
+
+// memorySource is a source of targets whose logs are held in memory
+type memorySource struct {
+	targets []*Target
+	logs    map[string][]memoryLine
+}
+
+func (s *memorySource) matching(filter *TargetFilter) []*Target {
+	var targets []*Target
+	for _, t := range s.targets {
+		if !filter.PodQuery.MatchString(t.Pod) || !filter.ContainerQuery.MatchString(t.Container) {
+			continue
+		}
+		if filter.ExcludeContainerQuery != nil && filter.ExcludeContainerQuery.MatchString(t.Container) {
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+func (s *memorySource) Watch(ctx context.Context, filter *TargetFilter) (<-chan *Target, <-chan *Target, error) {
+	added := make(chan *Target)
+	go func() {
+		for _, t := range s.matching(filter) {
+			select {
+			case added <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return added, make(chan *Target), nil
+}
+
+func (s *memorySource) List(ctx context.Context, filter *TargetFilter) ([]*Target, error) {
+	return s.matching(filter), nil
+}
+
+func (s *memorySource) Stream(ctx context.Context, target *Target, opts *StreamOptions) (io.ReadCloser, error) {
+	lines := s.logs[target.GetID()]
+	if opts.TailLines != nil && int64(len(lines)) > *opts.TailLines {
+		lines = lines[int64(len(lines))-*opts.TailLines:]
+	}
+	var buf bytes.Buffer
+	for _, l := range lines {
+		if opts.Timestamps {
+			buf.WriteString(l.time.Format(time.RFC3339Nano) + " ")
+		}
+		buf.WriteString(l.msg + "\n")
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+func newMemorySource() *memorySource {
+	start := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+	return &memorySource{
+		targets: []*Target{
+			{Namespace: "ns", Pod: "web-1", Container: "nginx"},
+			{Namespace: "ns", Pod: "web-1", Container: "istio-proxy"},
+			{Namespace: "ns", Pod: "db-0", Container: "postgres"},
+		},
+		logs: map[string][]memoryLine{
+			"ns-web-1-nginx": {
+				{start, "GET / 200"},
+				{start.Add(2 * time.Second), "GET /api 500"},
+			},
+			"ns-web-1-istio-proxy": {
+				{start.Add(time.Second), "proxy ready"},
+			},
+			"ns-db-0-postgres": {
+				{start.Add(3 * time.Second), "checkpoint complete"},
+			},
+		},
+	}
+}
+
+func newSourceConfig() *Config {
+	return &Config{
+		PodQuery:       regexp.MustCompile("^web"),
+		ContainerQuery: regexp.MustCompile(".*"),
+		LabelSelector:  labels.Everything(),
+		ContainerState: ContainerState{RUNNING},
+		Since:          time.Hour,
+		Template:       template.Must(template.New("").Parse("{{.PodName}} {{.ContainerName}} {{.Message}}")),
+		Backoff:        Backoff{MaxRetries: 0},
+	}
+}
+
+// syncBuffer is a buffer safe for concurrent writes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestRunSource(t *testing.T) {
+	config := newSourceConfig()
+	config.Exclude = []*regexp.Regexp{regexp.MustCompile("200")}
+
+	until := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(until) })
+	var out syncBuffer
+	if err := run(context.Background(), newMemorySource(), nil, config, &out, until); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out.buf.String()), "\n") {
+		if !strings.HasPrefix(line, "+") {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	expected := []string{"web-1 istio-proxy proxy ready", "web-1 nginx GET /api 500"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestTailTotalSource(t *testing.T) {
+	config := newSourceConfig()
+	config.PodQuery = regexp.MustCompile(".*")
+	config.ExcludeContainerQuery = regexp.MustCompile("istio-proxy")
+	two := int64(2)
+	config.TailTotal = &two
+
+	logC := make(chan string, 10)
+	fetched, err := tailTotal(context.Background(), newMemorySource(), config, nil, logC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(logC)
+
+	var lines []string
+	for line := range logC {
+		lines = append(lines, line)
+	}
+	expected := "web-1 nginx GET /api 500\ndb-0 postgres checkpoint complete\n"
+	if strings.Join(lines, "") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(lines, ""))
+	}
+	start := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+	if len(fetched) != 2 || !fetched["ns-db-0-postgres"].Equal(start.Add(3*time.Second)) || !fetched["ns-web-1-nginx"].Equal(start.Add(2*time.Second)) {
+		t.Errorf("unexpected fetched targets %v", fetched)
+	}
+}
+
+// laggingSource logs a line to a target of a memorySource once the targets
+// were listed, and fails to open its first streams
+type laggingSource struct {
+	*memorySource
+	id  string
+	msg string
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *laggingSource) Watch(ctx context.Context, filter *TargetFilter) (<-chan *Target, <-chan *Target, error) {
+	s.logs[s.id] = append(s.logs[s.id], memoryLine{time.Now(), s.msg})
+	return s.memorySource.Watch(ctx, filter)
+}
+
+func (s *laggingSource) Stream(ctx context.Context, target *Target, opts *StreamOptions) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target.GetID() == s.id && s.failures > 0 {
+		s.failures--
+		return nil, errors.New("connection reset by peer")
+	}
+	return s.memorySource.Stream(ctx, target, opts)
+}
+
+func TestRunTailTotalFollows(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int64
+		id       string
+		failures int
+		expected map[string]int
+	}{
+		{"after the fetched line", 1, "ns-web-1-nginx", 0, map[string]int{"GET / 200": 0, "GET /api 500": 1, "GET /health 200": 1}},
+		{"without fetching", 0, "ns-web-1-nginx", 0, map[string]int{"GET / 200": 0, "GET /api 500": 0, "GET /health 200": 1}},
+		{"after a failed fetch", 1, "ns-web-1-nginx", 1, map[string]int{"GET / 200": 0, "GET /api 500": 0, "GET /health 200": 1}},
+		{"empty container", 1, "ns-web-2-nginx", 0, map[string]int{"GET / 200": 0, "GET /api 500": 1, "GET /health 200": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newSourceConfig()
+			config.ContainerQuery = regexp.MustCompile("nginx")
+			config.TailTotal = &tt.total
+
+			source := &laggingSource{memorySource: newMemorySource(), id: tt.id, msg: "GET /health 200", failures: tt.failures}
+			source.targets = append(source.targets, &Target{Namespace: "ns", Pod: "web-2", Container: "nginx"})
+
+			until := make(chan struct{})
+			time.AfterFunc(100*time.Millisecond, func() { close(until) })
+			var out syncBuffer
+			if err := run(context.Background(), source, nil, config, &out, until); err != nil {
+				t.Fatal(err)
+			}
+
+			output := out.buf.String()
+			for line, n := range tt.expected {
+				if c := strings.Count(output, line); c != n {
+					t.Errorf("expected %q %d times, got %d in %q", line, n, c, output)
+				}
+			}
+		})
+	}
+}
+
+// slowWatchSource adds the targets of a memorySource after a delay
+type slowWatchSource struct {
+	*memorySource
+	delay time.Duration
+}
+
+func (s *slowWatchSource) Watch(ctx context.Context, filter *TargetFilter) (<-chan *Target, <-chan *Target, error) {
+	added := make(chan *Target)
+	go func() {
+		time.Sleep(s.delay)
+		for _, t := range s.matching(filter) {
+			select {
+			case added <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return added, make(chan *Target), nil
+}
+
+func TestRunDrainsTargetsNotWatchedYet(t *testing.T) {
+	config := newSourceConfig()
+	config.ContainerState = ContainerState{TERMINATED}
+
+	// like a Job which finished before its pods were watched
+	until := make(chan struct{})
+	close(until)
+	var out syncBuffer
+	source := &slowWatchSource{memorySource: newMemorySource(), delay: 300 * time.Millisecond}
+	if err := run(context.Background(), source, nil, config, &out, until); err != nil {
+		t.Fatal(err)
+	}
+
+	output := out.buf.String()
+	for _, expected := range []string{"GET /api 500", "proxy ready"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+}
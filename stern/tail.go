@@ -22,22 +22,34 @@ import (
 	"hash/fnv"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
-	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/rest"
 )
 
 type Tail struct {
 	Namespace      string
 	PodName        string
 	ContainerName  string
+	NodeName       string
 	Options        *TailOptions
-	req            *rest.Request
+	logC           chan<- string
+	hooks          *hookRunner
+	redactors      *redactors
+	lastSeen       time.Time
+	lastSeenMu     sync.Mutex
 	closed         chan struct{}
+	closeOnce      sync.Once
+	failed         chan struct{}
+	opened         chan struct{}
+	done           chan struct{}
+	retry          bool
+	err            error
 	Active         bool
 	podColor       *color.Color
 	containerColor *color.Color
@@ -51,6 +63,65 @@ type TailOptions struct {
 	Include      []*regexp.Regexp
 	Namespace    bool
 	TailLines    *int64
+	LimitBytes   *int64
+	OnlyLogLines bool
+
+	// Envelope fills in the timestamp of every line and reports the start and
+	// end of the tail as lifecycle events instead of the +/- markers, as
+	// needed by the versioned JSON output
+	Envelope bool
+
+	// Cluster is the name of the cluster reported in the JSON output
+	Cluster string
+
+	// Resume continues the logs after a previous tail when set, replacing
+	// SinceSeconds. Lines logged at or before it are skipped.
+	Resume time.Time
+
+	// TrackTime requests the timestamps of the lines to keep track of the
+	// last one seen, without printing them unless Timestamps is set
+	TrackTime bool
+
+	// Redact masks secrets in messages when set
+	Redact *strings.Replacer
+
+	// Sidecar only keeps the important lines of a quieted sidecar when set
+	Sidecar *SidecarProfile
+
+	// Headers marks lines with the header of the tail, for run to print them
+	// under headers instead of prefixing them
+	Headers bool
+}
+
+// matches returns true when the line passes the exclude and include filters
+func (o *TailOptions) matches(line string) bool {
+	if o.Sidecar != nil && !o.Sidecar.keep(line) {
+		return false
+	}
+
+	for _, rex := range o.Exclude {
+		if rex.MatchString(line) {
+			return false
+		}
+	}
+
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, rin := range o.Include {
+		if rin.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact masks the secrets in a message
+func (o *TailOptions) redact(msg string) string {
+	if o.Redact == nil {
+		return msg
+	}
+	return o.Redact.Replace(msg)
 }
 
 // NewTail returns a new tail for a Kubernetes container inside a pod
@@ -61,6 +132,9 @@ func NewTail(namespace, podName, containerName string, tmpl *template.Template,
 		ContainerName: containerName,
 		Options:       options,
 		closed:        make(chan struct{}),
+		failed:        make(chan struct{}),
+		opened:        make(chan struct{}),
+		done:          make(chan struct{}),
 		Active:        true,
 		tmpl:          tmpl,
 	}
@@ -86,33 +160,58 @@ func determineColor(podName string) (podColor, containerColor *color.Color) {
 
 // Start starts tailing
 func (t *Tail) Start(ctx context.Context, i v1.PodInterface, logC chan<- string) {
+	t.StartSource(ctx, &kubernetesSource{pods: func(string) v1.PodInterface { return i }}, logC)
+}
+
+// StartSource starts tailing the container from source
+func (t *Tail) StartSource(ctx context.Context, source Source, logC chan<- string) {
 	t.podColor, t.containerColor = determineColor(t.PodName)
+	t.logC = logC
 
 	go func() {
-		g := color.New(color.FgHiGreen, color.Bold).SprintFunc()
-		p := t.podColor.SprintFunc()
-		c := t.containerColor.SprintFunc()
-		if t.Options.Namespace {
-			logC <- fmt.Sprintf("%s %s %s › %s\n", g("+"), p(t.Namespace), p(t.PodName), c(t.ContainerName))
-		} else {
-			logC <- fmt.Sprintf("%s %s › %s\n", g("+"), p(t.PodName), c(t.ContainerName))
+		defer close(t.done)
+
+		// a retry continues the tail that failed, which was announced
+		if t.Options.Envelope && !t.Options.OnlyLogLines && !t.retry {
+			logC <- t.printEvent(EventAdded)
+		} else if !t.Options.OnlyLogLines && !t.retry {
+			logC <- t.addedMarker()
 		}
 
-		req := i.GetLogs(t.PodName, &corev1.PodLogOptions{
+		opts := &StreamOptions{
 			Follow:       true,
-			Timestamps:   t.Options.Timestamps,
-			Container:    t.ContainerName,
+			Timestamps:   t.Options.Timestamps || t.Options.Envelope || t.Options.TrackTime || !t.Options.Resume.IsZero(),
 			SinceSeconds: &t.Options.SinceSeconds,
 			TailLines:    t.Options.TailLines,
-		})
+			LimitBytes:   t.Options.LimitBytes,
+		}
+		if !t.Options.Resume.IsZero() {
+			opts.SinceTime = &t.Options.Resume
+		}
+		target := &Target{Namespace: t.Namespace, Pod: t.PodName, Container: t.ContainerName, Node: t.NodeName}
+
+		// the secrets are looked up before the stream opens, so a target whose
+		// secrets can't be read fails instead of being tailed unredacted
+		if t.redactors != nil {
+			redactor, err := t.redactors.forTarget(target)
+			if err != nil {
+				t.err = err
+				t.Active = false
+				close(t.failed)
+				return
+			}
+			t.Options.Redact = redactor
+		}
 
-		stream, err := req.Stream()
+		stream, err := source.Stream(ctx, target, opts)
 		if err != nil {
-			fmt.Println(errors.Wrapf(err, "Error opening stream to %s/%s: %s\n", t.Namespace, t.PodName, t.ContainerName))
+			t.err = errors.Wrapf(err, "error opening stream to %s/%s: %s", t.Namespace, t.PodName, t.ContainerName)
 			t.Active = false
+			close(t.failed)
 			return
 		}
 		defer stream.Close()
+		close(t.opened)
 
 		go func() {
 			<-t.closed
@@ -122,67 +221,178 @@ func (t *Tail) Start(ctx context.Context, i v1.PodInterface, logC chan<- string)
 
 		reader := bufio.NewReader(stream)
 
-	OUTER:
 		for {
 			line, err := reader.ReadBytes('\n')
 			if err != nil {
 				return
 			}
 
-			str := string(line)
-
-			for _, rex := range t.Options.Exclude {
-				if rex.MatchString(str) {
-					continue OUTER
-				}
+			ts, str := t.splitTimestamp(string(line))
+			if !t.Options.Resume.IsZero() && !ts.After(t.Options.Resume) {
+				continue
 			}
-
-			if len(t.Options.Include) != 0 {
-				matches := false
-				for _, rin := range t.Options.Include {
-					if rin.MatchString(str) {
-						matches = true
-						break
-					}
-				}
-				if !matches {
-					continue OUTER
-				}
+			if !t.Options.matches(str) {
+				t.setLastSeen(ts)
+				continue
 			}
 
-			logC <- t.Print(str)
+			logC <- t.printAt(ts, str)
+			t.setLastSeen(ts)
+			t.hooks.run(t, t.Options.redact(str))
 		}
 	}()
 
 	go func() {
 		<-ctx.Done()
-		close(t.closed)
+		t.closeOnce.Do(func() { close(t.closed) })
 	}()
 }
 
 // Close stops tailing
 func (t *Tail) Close() {
+	if t.Options.Envelope && !t.Options.OnlyLogLines {
+		if t.logC != nil {
+			t.logC <- t.printEvent(EventRemoved)
+		}
+	} else if !t.Options.OnlyLogLines {
+		fmt.Fprint(os.Stderr, t.removedMarker())
+	}
+	t.stop()
+}
+
+// stop stops tailing without announcing it, for a tail being retried
+func (t *Tail) stop() {
+	t.closeOnce.Do(func() { close(t.closed) })
+}
+
+// addedMarker returns the line announcing that the container is tailed
+func (t *Tail) addedMarker() string {
+	g := color.New(color.FgHiGreen, color.Bold).SprintFunc()
+	p := t.podColor.SprintFunc()
+	c := t.containerColor.SprintFunc()
+	if t.Options.Namespace {
+		return fmt.Sprintf("%s %s %s › %s\n", g("+"), p(t.Namespace), p(t.PodName), c(t.ContainerName))
+	}
+	return fmt.Sprintf("%s %s › %s\n", g("+"), p(t.PodName), c(t.ContainerName))
+}
+
+// removedMarker returns the line announcing that the pod isn't tailed anymore
+func (t *Tail) removedMarker() string {
 	r := color.New(color.FgHiRed, color.Bold).SprintFunc()
 	p := t.podColor.SprintFunc()
 	if t.Options.Namespace {
-		fmt.Fprintf(os.Stderr, "%s %s %s\n", r("-"), p(t.Namespace), p(t.PodName))
-	} else {
-		fmt.Fprintf(os.Stderr, "%s %s\n", r("-"), p(t.PodName))
+		return fmt.Sprintf("%s %s %s\n", r("-"), p(t.Namespace), p(t.PodName))
+	}
+	return fmt.Sprintf("%s %s\n", r("-"), p(t.PodName))
+}
+
+// Failed returns a channel which is closed when the log stream could not be
+// opened
+func (t *Tail) Failed() <-chan struct{} {
+	return t.failed
+}
+
+// Opened returns a channel which is closed once the log stream was opened
+func (t *Tail) Opened() <-chan struct{} {
+	return t.opened
+}
+
+// Done returns a channel which is closed when the tail stopped reading logs,
+// because the log stream ended, failed or the tail was closed
+func (t *Tail) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the reason the tail failed
+func (t *Tail) Err() error {
+	select {
+	case <-t.failed:
+		return t.err
+	default:
+		return nil
 	}
-	close(t.closed)
 }
 
 // Print prints a color coded log message with the pod and container names
 func (t *Tail) Print(msg string) string {
-	vm := Log{
-		Message:        msg,
+	return t.printAt(time.Time{}, msg)
+}
+
+// splitTimestamp splits the timestamp requested for the JSON output, for
+// resuming from a line or for tracking time. The line keeps it when
+// Timestamps asked for it.
+func (t *Tail) splitTimestamp(line string) (time.Time, string) {
+	if !t.Options.Envelope && !t.Options.TrackTime && t.Options.Resume.IsZero() {
+		return time.Time{}, line
+	}
+	ts, msg := splitTimestamp(line)
+	if t.Options.Timestamps && !t.Options.Envelope {
+		return ts, line
+	}
+	return ts, msg
+}
+
+func (t *Tail) setLastSeen(ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+	t.lastSeenMu.Lock()
+	defer t.lastSeenMu.Unlock()
+	t.lastSeen = ts
+}
+
+// LastSeen returns the time of the last line handed to the log channel, or
+// filtered out, when the time of lines is known. That is the case when
+// resuming or for the JSON output.
+func (t *Tail) LastSeen() time.Time {
+	t.lastSeenMu.Lock()
+	defer t.lastSeenMu.Unlock()
+	return t.lastSeen
+}
+
+// printAt prints a log message logged at ts, which may be zero when unknown
+func (t *Tail) printAt(ts time.Time, msg string) string {
+	vm := t.log()
+	vm.Message = t.Options.redact(msg)
+	if !ts.IsZero() {
+		vm.Timestamp = ts.Format(time.RFC3339Nano)
+	}
+	return t.print(vm)
+}
+
+// printTimed prints a log message logged at ts which doesn't come from the
+// Kubernetes API, prefixing it with ts like the API would with --timestamps
+func (t *Tail) printTimed(ts time.Time, msg string) string {
+	if t.Options.Timestamps && !t.Options.Envelope && !ts.IsZero() {
+		if prefix, _ := splitTimestamp(msg); prefix.IsZero() {
+			msg = ts.Format(time.RFC3339Nano) + " " + msg
+		}
+	}
+	return t.printAt(ts, msg)
+}
+
+// printEvent prints a lifecycle event of the tail
+func (t *Tail) printEvent(event string) string {
+	vm := t.log()
+	vm.Event = event
+	return t.print(vm)
+}
+
+// log returns the log describing the tail, without a message
+func (t *Tail) log() Log {
+	return Log{
 		Namespace:      t.Namespace,
 		PodName:        t.PodName,
 		ContainerName:  t.ContainerName,
+		NodeName:       t.NodeName,
+		Cluster:        t.Options.Cluster,
 		PodColor:       t.podColor,
 		ContainerColor: t.containerColor,
 	}
+}
 
+// print expands the template for a log
+func (t *Tail) print(vm Log) string {
 	var buf bytes.Buffer
 	err := t.tmpl.Execute(&buf, vm)
 	if err != nil {
@@ -190,6 +400,9 @@ func (t *Tail) Print(msg string) string {
 		return ""
 	}
 
+	if t.Options.Headers {
+		return t.withHeader(buf.String())
+	}
 	return buf.String()
 }
 
@@ -208,6 +421,25 @@ type Log struct {
 	// ContainerName of the container
 	ContainerName string `json:"containerName"`
 
+	// the fields below aren't marshaled, so {{json .}} prints what it did
+	// before the JSON output was versioned; envelope records them
+
+	// NodeName of the node the pod runs on, if known
+	NodeName string `json:"-"`
+
+	// Cluster of the pod, if known
+	Cluster string `json:"-"`
+
+	// Timestamp of the message in RFC 3339 format, when it is known
+	Timestamp string `json:"-"`
+
+	// Stream is stdout or stderr when the source of the logs tells them apart
+	Stream string `json:"-"`
+
+	// Event is the lifecycle event of the container when this isn't a log
+	// message, one of EventAdded or EventRemoved
+	Event string `json:"-"`
+
 	PodColor       *color.Color `json:"-"`
 	ContainerColor *color.Color `json:"-"`
 }
@@ -1,6 +1,11 @@
 package stern
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+	"text/template"
+	"time"
+)
 
 func TestDetermineColor(t *testing.T) {
 	podName := "stern"
@@ -16,3 +21,59 @@ func TestDetermineColor(t *testing.T) {
 			containerColor1, containerColor2)
 	}
 }
+
+func TestTemplateFor(t *testing.T) {
+	def := template.Must(template.New("default").Parse("{{.PodName}} {{.Message}}"))
+	raw := template.Must(template.New("raw").Parse("{{.Message}}"))
+	json := template.Must(template.New("json").Parse("{{.ContainerName}} {{.Message}}"))
+
+	config := &Config{
+		Template: def,
+		TemplateRules: []TemplateRule{
+			{ContainerQuery: regexp.MustCompile("^nginx$"), Template: raw},
+			{PodQuery: regexp.MustCompile("^api-"), ContainerQuery: regexp.MustCompile("^app$"), Template: json},
+		},
+	}
+
+	tests := []struct {
+		target   Target
+		expected *template.Template
+	}{
+		{Target{Pod: "web-1", Container: "nginx"}, raw},
+		{Target{Pod: "api-1", Container: "nginx"}, raw},
+		{Target{Pod: "api-1", Container: "app"}, json},
+		{Target{Pod: "web-1", Container: "app"}, def},
+	}
+
+	for _, tt := range tests {
+		if actual := config.templateFor(&tt.target); actual != tt.expected {
+			t.Errorf("%s/%s: expected template %s, got %s", tt.target.Pod, tt.target.Container, tt.expected.Name(), actual.Name())
+		}
+	}
+}
+
+func TestTailSplitTimestamp(t *testing.T) {
+	line := "2019-08-01T10:00:00.123456789Z hello\n"
+	ts := time.Date(2019, 8, 1, 10, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		options  TailOptions
+		ts       time.Time
+		expected string
+	}{
+		{TailOptions{}, time.Time{}, line},
+		{TailOptions{Timestamps: true}, time.Time{}, line},
+		{TailOptions{Envelope: true}, ts, "hello\n"},
+		{TailOptions{Envelope: true, Timestamps: true}, ts, "hello\n"},
+		{TailOptions{Resume: ts.Add(-time.Hour)}, ts, "hello\n"},
+		{TailOptions{Resume: ts.Add(-time.Hour), Timestamps: true}, ts, line},
+	}
+
+	for i, tt := range tests {
+		tail := NewTail("ns", "pod", "app", nil, &tt.options)
+		actual, msg := tail.splitTimestamp(line)
+		if !actual.Equal(tt.ts) || msg != tt.expected {
+			t.Errorf("%d: expected %s %q, got %s %q", i, tt.ts, tt.expected, actual, msg)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timestampedLine is a log line fetched with its timestamp
+type timestampedLine struct {
+	time time.Time
+	tail *Tail
+	line string
+}
+
+// splitTimestamp splits the timestamp added by the Kubernetes API from a line
+func splitTimestamp(line string) (time.Time, string) {
+	idx := strings.IndexByte(line, ' ')
+	if idx < 0 {
+		return time.Time{}, line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line[:idx])
+	if err != nil {
+		return time.Time{}, line
+	}
+	return ts, line[idx+1:]
+}
+
+// mostRecent orders lines by time and returns the n most recent ones
+func mostRecent(lines []timestampedLine, n int64) []timestampedLine {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].time.Before(lines[j].time)
+	})
+	if int64(len(lines)) > n {
+		lines = lines[int64(len(lines))-n:]
+	}
+	return lines
+}
+
+// tailTotal sends the n most recent lines across all matched containers to
+// logC, ordered by time. It returns the time of the last line fetched from
+// each listed target, or the time the fetch started when there was none, so
+// that following it resumes after that line. The filters apply to the n most
+// recent lines of every container, fewer lines are shown when they don't
+// match.
+func tailTotal(ctx context.Context, source Source, config *Config, redact *redactors, logC chan<- string) (map[string]time.Time, error) {
+	n := *config.TailTotal
+
+	targets, err := source.List(ctx, config.targetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	// the most recent n lines overall are among the most recent n lines of
+	// every container
+	tailLines := n
+	if config.TailLines != nil && *config.TailLines < n {
+		tailLines = *config.TailLines
+	}
+
+	start := time.Now()
+	fetched := make(map[string]time.Time)
+	for _, t := range targets {
+		fetched[t.GetID()] = start
+	}
+	if n == 0 {
+		return fetched, nil
+	}
+
+	var mu sync.Mutex
+	var lines []timestampedLine
+	forEachTarget(ctx, targets, config.MaxLogRequests, func(_ int, t *Target) {
+		tail := newTail(t, config)
+		tail.podColor, tail.containerColor = determineColor(tail.PodName)
+		redactor, err := redact.forTarget(t)
+		if err != nil {
+			mu.Lock()
+			printTailStatus(tail, err.Error())
+			mu.Unlock()
+			return
+		}
+		tail.Options.Redact = redactor
+
+		var own []timestampedLine
+		var last time.Time
+		err = fetchLogs(ctx, source, t, &StreamOptions{
+			Timestamps:   true,
+			SinceSeconds: &tail.Options.SinceSeconds,
+			TailLines:    &tailLines,
+			LimitBytes:   tail.Options.LimitBytes,
+		}, func(line string) {
+			ts, msg := splitTimestamp(line)
+			last = ts
+			if config.Timestamps && !config.Envelope {
+				msg = line
+			}
+			if !tail.Options.matches(msg) {
+				return
+			}
+			own = append(own, timestampedLine{time: ts, tail: tail, line: msg})
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			printTailStatus(tail, err.Error())
+			return
+		}
+		lines = append(lines, own...)
+		if !last.IsZero() {
+			fetched[t.GetID()] = last
+		}
+	})
+
+	for _, l := range mostRecent(lines, n) {
+		if config.Envelope {
+			logC <- l.tail.printAt(l.time, l.line)
+		} else {
+			logC <- l.tail.Print(l.line)
+		}
+	}
+
+	return fetched, nil
+}
@@ -0,0 +1,46 @@
+package stern
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitTimestamp(t *testing.T) {
+	ts, msg := splitTimestamp("2019-08-29T10:11:12.123456789Z hello world\n")
+	if expected := time.Date(2019, 8, 29, 10, 11, 12, 123456789, time.UTC); !ts.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, ts)
+	}
+	if msg != "hello world\n" {
+		t.Errorf("expected message without timestamp, got %q", msg)
+	}
+
+	ts, msg = splitTimestamp("no timestamp here\n")
+	if !ts.IsZero() || msg != "no timestamp here\n" {
+		t.Errorf("expected line to be untouched, got %s %q", ts, msg)
+	}
+}
+
+func TestMostRecent(t *testing.T) {
+	base := time.Date(2019, 8, 29, 10, 0, 0, 0, time.UTC)
+	lines := []timestampedLine{
+		{time: base.Add(3 * time.Second), line: "a3"},
+		{time: base.Add(1 * time.Second), line: "a1"},
+		{time: base.Add(4 * time.Second), line: "b4"},
+		{time: base.Add(2 * time.Second), line: "b2"},
+	}
+
+	recent := mostRecent(lines, 3)
+	expected := []string{"b2", "a3", "b4"}
+	if len(recent) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(recent))
+	}
+	for i := range expected {
+		if recent[i].line != expected[i] {
+			t.Errorf("%d: expected %s, got %s", i, expected[i], recent[i].line)
+		}
+	}
+
+	if len(mostRecent(lines, 10)) != 4 {
+		t.Errorf("expected all lines when n exceeds the number of lines")
+	}
+}
@@ -0,0 +1,254 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace converts logs into events of the Chrome Trace Event format, which
+// Perfetto and chrome://tracing load. Every pod is a process and every
+// container a thread of it. The lifetimes of the tails are duration slices,
+// lines instant events and lines with a request duration complete slices.
+//
+// The events form the JSON Array Format once written by a traceWriter.
+type Trace struct {
+	mu       sync.Mutex
+	pids     map[string]int
+	tids     map[string]int
+	starts   map[string]int
+	now      func() time.Time
+	nextPID  int
+	nextTIDs map[int]int
+}
+
+// NewTrace returns a trace without events
+func NewTrace() *Trace {
+	return &Trace{
+		pids:     make(map[string]int),
+		tids:     make(map[string]int),
+		starts:   make(map[string]int),
+		nextTIDs: make(map[int]int),
+		now:      time.Now,
+	}
+}
+
+// traceEvent is an event of the Chrome Trace Event format
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Cat   string            `json:"cat,omitempty"`
+	Phase string            `json:"ph"`
+	TS    int64             `json:"ts"`
+	Dur   *int64            `json:"dur,omitempty"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Scope string            `json:"s,omitempty"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+// maxTraceNameLength truncates the messages naming instant events
+const maxTraceNameLength = 80
+
+// Event returns the events of a log, separated by commas
+func (t *Trace) Event(log Log) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ts := t.now()
+	if log.Timestamp != "" {
+		if parsed, err := time.Parse(time.RFC3339Nano, log.Timestamp); err == nil {
+			ts = parsed
+		}
+	}
+	micros := ts.UnixNano() / int64(time.Microsecond)
+
+	var events []traceEvent
+	pid, tid, metadata := t.track(log)
+	events = append(events, metadata...)
+
+	key := log.Namespace + "/" + log.PodName + "/" + log.ContainerName
+	switch log.Event {
+	case EventAdded:
+		t.starts[key]++
+		name := "running"
+		if n := t.starts[key]; n > 1 {
+			name = fmt.Sprintf("restart %d", n-1)
+		}
+		events = append(events, traceEvent{Name: name, Cat: "lifecycle", Phase: "B", TS: micros, PID: pid, TID: tid})
+	case EventRemoved:
+		events = append(events, traceEvent{Name: "terminated", Cat: "lifecycle", Phase: "E", TS: micros, PID: pid, TID: tid})
+	default:
+		msg := strings.TrimRight(log.Message, "\r\n")
+		args := map[string]string{"message": msg}
+		if d, ok := parseRequestDuration(msg); ok {
+			dur := int64(d / time.Microsecond)
+			events = append(events, traceEvent{Name: requestName(msg), Cat: "request", Phase: "X", TS: micros - dur, Dur: &dur, PID: pid, TID: tid, Args: args})
+		} else {
+			events = append(events, traceEvent{Name: traceName(msg), Cat: "log", Phase: "i", TS: micros, PID: pid, TID: tid, Scope: "t", Args: args})
+		}
+	}
+
+	var b strings.Builder
+	for i, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		b.Write(data)
+	}
+	return b.String(), nil
+}
+
+// traceWriter writes the events of a trace to out as a JSON array, opening it
+// before the first events and closing it on Close. Every write holds the
+// events of a log. The closing bracket is optional in the Trace Event format,
+// so a session killed at any time can still be loaded.
+type traceWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	started bool
+}
+
+func newTraceWriter(out io.Writer) *traceWriter {
+	return &traceWriter{out: out}
+}
+
+func (w *traceWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sep := ",\n"
+	if !w.started {
+		sep = "[\n"
+		w.started = true
+	}
+	if _, err := io.WriteString(w.out, sep); err != nil {
+		return 0, err
+	}
+	return w.out.Write(p)
+}
+
+// Close closes the array, which is empty when nothing was written
+func (w *traceWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	end := "\n]\n"
+	if !w.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.out, end)
+	return err
+}
+
+// track returns the process and thread of the container of a log, with the
+// metadata events naming them the first time they're seen
+func (t *Trace) track(log Log) (int, int, []traceEvent) {
+	var metadata []traceEvent
+	pod := log.Namespace + "/" + log.PodName
+	pid, ok := t.pids[pod]
+	if !ok {
+		t.nextPID++
+		pid = t.nextPID
+		t.pids[pod] = pid
+		metadata = append(metadata, traceEvent{Name: "process_name", Phase: "M", PID: pid, Args: map[string]string{"name": pod}})
+	}
+
+	container := pod + "/" + log.ContainerName
+	tid, ok := t.tids[container]
+	if !ok {
+		t.nextTIDs[pid]++
+		tid = t.nextTIDs[pid]
+		t.tids[container] = tid
+		metadata = append(metadata, traceEvent{Name: "thread_name", Phase: "M", PID: pid, TID: tid, Args: map[string]string{"name": log.ContainerName}})
+	}
+	return pid, tid, metadata
+}
+
+// traceName returns the name of the instant event of a message
+func traceName(msg string) string {
+	if len(msg) <= maxTraceNameLength {
+		return msg
+	}
+	return strings.ToValidUTF8(msg[:maxTraceNameLength], "") + "…"
+}
+
+var (
+	// requestDuration matches the duration of a request in a line, like
+	// took=12ms, "latency": "1.2s" or request_time=0.003
+	requestDuration = regexp.MustCompile(`(?i)\b(duration|latency|elapsed|took|request_time|response_time)(_ms|_us|_s|_seconds)?"?\s*[:=]?\s*"?((?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h))+|\d+(?:\.\d+)?)\b`)
+
+	// requestLine matches the method and path of a request
+	requestLine = regexp.MustCompile(`\b(GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS) (/\S*)`)
+)
+
+// parseRequestDuration returns the duration of the request a message
+// reports. Bare numbers need a unit in the key, except for the request_time
+// of nginx and the like, which is in seconds.
+func parseRequestDuration(msg string) (time.Duration, bool) {
+	m := requestDuration.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, false
+	}
+	key, suffix, value := strings.ToLower(m[1]), strings.ToLower(m[2]), strings.ToLower(m[3])
+
+	if last := value[len(value)-1]; last < '0' || last > '9' {
+		d, err := time.ParseDuration(value)
+		return d, err == nil
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	var unit time.Duration
+	switch {
+	case suffix == "_ms":
+		unit = time.Millisecond
+	case suffix == "_us":
+		unit = time.Microsecond
+	case suffix == "_s" || suffix == "_seconds" || key == "request_time" || key == "response_time":
+		unit = time.Second
+	default:
+		return 0, false
+	}
+	return time.Duration(n * float64(unit)), true
+}
+
+// requestName returns the method and path of a request, without its query
+func requestName(msg string) string {
+	m := requestLine.FindStringSubmatch(msg)
+	if m == nil {
+		return "request"
+	}
+	path := m[2]
+	if i := strings.IndexAny(path, "?\""); i >= 0 {
+		path = path[:i]
+	}
+	return m[1] + " " + path
+}
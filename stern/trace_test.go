@@ -0,0 +1,141 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stern
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	trace := NewTrace()
+	now := time.Date(2019, 6, 20, 10, 0, 0, 0, time.UTC)
+	trace.now = func() time.Time { return now }
+
+	logs := []Log{
+		{Namespace: "ns", PodName: "web-1", ContainerName: "nginx", Event: EventAdded},
+		{Namespace: "ns", PodName: "web-1", ContainerName: "nginx", Timestamp: "2019-06-20T10:00:01Z", Message: "GET /api?id=1 HTTP/1.1 200 request_time=0.250\n"},
+		{Namespace: "ns", PodName: "web-1", ContainerName: "app", Timestamp: "2019-06-20T10:00:02Z", Message: "listening\n"},
+		{Namespace: "ns", PodName: "web-1", ContainerName: "nginx", Event: EventRemoved},
+		{Namespace: "ns", PodName: "web-1", ContainerName: "nginx", Event: EventAdded},
+	}
+	var out strings.Builder
+	w := newTraceWriter(&out)
+	for _, log := range logs {
+		s, err := trace.Event(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, s)
+	}
+
+	if !strings.HasPrefix(out.String(), "[\n{") {
+		t.Errorf("expected the array to be opened, got %q", out.String())
+	}
+	w.Close()
+	var events []traceEvent
+	if err := json.Unmarshal([]byte(out.String()), &events); err != nil {
+		t.Fatal(err)
+	}
+
+	start := now.UnixNano() / int64(time.Microsecond)
+	dur := int64(250000)
+	expected := []traceEvent{
+		{Name: "process_name", Phase: "M", PID: 1, Args: map[string]string{"name": "ns/web-1"}},
+		{Name: "thread_name", Phase: "M", PID: 1, TID: 1, Args: map[string]string{"name": "nginx"}},
+		{Name: "running", Cat: "lifecycle", Phase: "B", TS: start, PID: 1, TID: 1},
+		{Name: "GET /api", Cat: "request", Phase: "X", TS: start + 1000000 - dur, Dur: &dur, PID: 1, TID: 1, Args: map[string]string{"message": "GET /api?id=1 HTTP/1.1 200 request_time=0.250"}},
+		{Name: "thread_name", Phase: "M", PID: 1, TID: 2, Args: map[string]string{"name": "app"}},
+		{Name: "listening", Cat: "log", Phase: "i", TS: start + 2000000, PID: 1, TID: 2, Scope: "t", Args: map[string]string{"message": "listening"}},
+		{Name: "terminated", Cat: "lifecycle", Phase: "E", TS: start, PID: 1, TID: 1},
+		{Name: "restart 1", Cat: "lifecycle", Phase: "B", TS: start, PID: 1, TID: 1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %s", len(expected), len(events), out.String())
+	}
+	for i, e := range expected {
+		actual, _ := json.Marshal(events[i])
+		want, _ := json.Marshal(e)
+		if string(actual) != string(want) {
+			t.Errorf("%d: expected %s, got %s", i, want, actual)
+		}
+	}
+}
+
+func TestTraceWriterEmpty(t *testing.T) {
+	var out strings.Builder
+	newTraceWriter(&out).Close()
+
+	var events []traceEvent
+	if err := json.Unmarshal([]byte(out.String()), &events); err != nil || len(events) != 0 {
+		t.Errorf("expected an empty array, got %q: %v", out.String(), err)
+	}
+}
+
+func TestRunSourceTrace(t *testing.T) {
+	config := newSourceConfig()
+	config.PodQuery = regexp.MustCompile(".*")
+	config.Envelope = true
+	config.Trace = true
+	trace := NewTrace()
+	config.Template = template.Must(template.New("").Funcs(map[string]interface{}{"trace": trace.Event}).Parse("{{trace .}}"))
+
+	// the tails all print their added event at once
+	for i := 0; i < 5; i++ {
+		until := make(chan struct{})
+		time.AfterFunc(100*time.Millisecond, func() { close(until) })
+		var out syncBuffer
+		if err := run(context.Background(), newMemorySource(), nil, config, &out, until); err != nil {
+			t.Fatal(err)
+		}
+
+		var events []traceEvent
+		if err := json.Unmarshal(out.buf.Bytes(), &events); err != nil {
+			t.Fatalf("invalid trace %q: %s", out.buf.String(), err)
+		}
+		if len(events) == 0 {
+			t.Errorf("expected events")
+		}
+	}
+}
+
+func TestParseRequestDuration(t *testing.T) {
+	tests := []struct {
+		msg      string
+		expected time.Duration
+		ok       bool
+	}{
+		{"handled request took=12ms", 12 * time.Millisecond, true},
+		{`{"msg":"done","latency":"1.5s"}`, 1500 * time.Millisecond, true},
+		{"duration: 1m2s", time.Minute + 2*time.Second, true},
+		{"duration_ms=40", 40 * time.Millisecond, true},
+		{`"elapsed_us": 250`, 250 * time.Microsecond, true},
+		{"upstream request_time=0.003", 3 * time.Millisecond, true},
+		{"duration=40", 0, false},
+		{"retrying in 5s", 0, false},
+	}
+	for _, tt := range tests {
+		d, ok := parseRequestDuration(tt.msg)
+		if d != tt.expected || ok != tt.ok {
+			t.Errorf("%q: expected %s, %t, got %s, %t", tt.msg, tt.expected, tt.ok, d, ok)
+		}
+	}
+}
@@ -33,6 +33,8 @@ type Target struct {
 	Namespace string
 	Pod       string
 	Container string
+	Node      string
+	Image     string
 }
 
 // GetID returns the ID of the object
@@ -72,24 +74,13 @@ func Watch(ctx context.Context, i v1.PodInterface, podFilter *regexp.Regexp, con
 
 				switch e.Type {
 				case watch.Added, watch.Modified:
-					var statuses []corev1.ContainerStatus
-					statuses = append(statuses, pod.Status.ContainerStatuses...)
-					if initContainers {
-						statuses = append(statuses, pod.Status.InitContainerStatuses...)
-					}
-
-					for _, c := range statuses {
-						if !containerFilter.MatchString(c.Name) {
-							continue
-						}
-						if containerExcludeFilter != nil && containerExcludeFilter.MatchString(c.Name) {
-							continue
-						}
-
+					for _, c := range matchingStatuses(pod, containerFilter, containerExcludeFilter, initContainers) {
 						t := &Target{
 							Namespace: pod.Namespace,
 							Pod:       pod.Name,
 							Container: c.Name,
+							Node:      pod.Spec.NodeName,
+							Image:     c.Image,
 						}
 						if containerState.Match(c.State) {
 							added <- t
@@ -130,3 +121,57 @@ func Watch(ctx context.Context, i v1.PodInterface, podFilter *regexp.Regexp, con
 
 	return added, removed, nil
 }
+
+// List returns the containers currently matching the filters, in the same way
+// Watch would emit them as added
+func List(i v1.PodInterface, podFilter *regexp.Regexp, containerFilter *regexp.Regexp, containerExcludeFilter *regexp.Regexp, initContainers bool, containerState ContainerState, labelSelector labels.Selector) ([]*Target, error) {
+	pods, err := i.List(metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+
+	var targets []*Target
+	for idx := range pods.Items {
+		pod := &pods.Items[idx]
+		if !podFilter.MatchString(pod.Name) {
+			continue
+		}
+
+		for _, c := range matchingStatuses(pod, containerFilter, containerExcludeFilter, initContainers) {
+			if !containerState.Match(c.State) {
+				continue
+			}
+			targets = append(targets, &Target{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: c.Name,
+				Node:      pod.Spec.NodeName,
+				Image:     c.Image,
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+// matchingStatuses returns the statuses of the containers of a pod which match
+// the container filters
+func matchingStatuses(pod *corev1.Pod, containerFilter *regexp.Regexp, containerExcludeFilter *regexp.Regexp, initContainers bool) []corev1.ContainerStatus {
+	var statuses []corev1.ContainerStatus
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	if initContainers {
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	}
+
+	var matching []corev1.ContainerStatus
+	for _, c := range statuses {
+		if !containerFilter.MatchString(c.Name) {
+			continue
+		}
+		if containerExcludeFilter != nil && containerExcludeFilter.MatchString(c.Name) {
+			continue
+		}
+		matching = append(matching, c)
+	}
+	return matching
+}
@@ -0,0 +1,53 @@
+package stern
+
+import (
+	"regexp"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestList(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1"},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{Name: "migrate", State: terminated}},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "app", State: running},
+					{Name: "istio-proxy", State: running},
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-1"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "postgres", State: running}},
+			},
+		},
+	)
+
+	targets, err := List(clientset.CoreV1().Pods("default"),
+		regexp.MustCompile("web"),
+		regexp.MustCompile(".*"),
+		regexp.MustCompile("istio"),
+		true,
+		ContainerState{RUNNING},
+		labels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %d", len(targets))
+	}
+	if id := targets[0].GetID(); id != "default-web-1-app" {
+		t.Errorf("expected target default-web-1-app, got %s", id)
+	}
+}